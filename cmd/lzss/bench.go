@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"time"
+
+	"github.com/satinxs/lzss_rosetta/lzss"
+)
+
+// Input sizes each profile is benchmarked at
+var benchSizes = []int{64 * 1024, 1024 * 1024}
+
+type benchProfile struct {
+	name  string
+	input func(size int) []byte
+}
+
+// Random bytes don't compress, repetitive ones are mostly maximum length matches, and text
+// is the given file repeated or cut to size
+func getBenchProfiles(text []byte) []benchProfile {
+	return []benchProfile{
+		{"random", func(size int) []byte {
+			input := make([]byte, size)
+			rand.New(rand.NewSource(1)).Read(input)
+			return input
+		}},
+		{"repetitive", func(size int) []byte {
+			return bytes.Repeat([]byte("abcabcabd"), size/9+1)[:size]
+		}},
+		{"text", func(size int) []byte {
+			return bytes.Repeat(text, size/max(len(text), 1)+1)[:size]
+		}},
+	}
+}
+
+type benchConfig struct {
+	name  string
+	codec lzss.Lzss
+}
+
+var benchConfigs = []benchConfig{
+	{"10,6,2", lzss.NewLzss(10, 6, 2)},
+	{"14,4,3", lzss.NewLzss(14, 4, 3)},
+	{"14,4,3/tree", withTreeFinder(lzss.NewLzss(14, 4, 3))},
+	{"14,4,3/suffix", withSuffixArrayFinder(lzss.NewLzss(14, 4, 3))},
+}
+
+// The same parameters matched with NewTreeFinder instead of the built-in hash chain
+func withTreeFinder(l lzss.Lzss) lzss.Lzss {
+	l.Finder = l.NewTreeFinder()
+	return l
+}
+
+// The same parameters matched with NewSuffixArrayFinder
+func withSuffixArrayFinder(l lzss.Lzss) lzss.Lzss {
+	l.Finder = l.NewSuffixArrayFinder()
+	return l
+}
+
+// How long each measurement runs at least, doubling the iterations until it does
+const benchTime = time.Second
+
+type benchResult struct {
+	iterations int
+	elapsed    time.Duration
+	bytes      int
+	allocs     uint64
+	allocBytes uint64
+}
+
+// Formats the result like the testing package does, per operation
+func (r benchResult) String() string {
+	n := uint64(r.iterations)
+	perOp := r.elapsed.Nanoseconds() / int64(r.iterations)
+	throughput := float64(r.bytes) * float64(r.iterations) / 1e6 / r.elapsed.Seconds()
+
+	return fmt.Sprintf("%8d %12d ns/op %8.2f MB/s %10d B/op %6d allocs/op", r.iterations, perOp, throughput, r.allocBytes/n, r.allocs/n)
+}
+
+// Runs f on size bytes of input for at least benchTime, counting the allocations it makes.
+// The CLI times the codec itself so the binary doesn't link the testing package.
+func measure(size int, f func()) benchResult {
+	var before, after runtime.MemStats
+
+	for n := 1; ; n *= 2 {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+
+		for i := 0; i < n; i += 1 {
+			f()
+		}
+
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+
+		if elapsed >= benchTime {
+			return benchResult{n, elapsed, size, after.Mallocs - before.Mallocs, after.TotalAlloc - before.TotalAlloc}
+		}
+	}
+}
+
+// Benchmarks Encode and Decode of every profile, size and config, one line each
+func runBenchmarks(w io.Writer, text []byte) error {
+	for _, profile := range getBenchProfiles(text) {
+		for _, size := range benchSizes {
+			input := profile.input(size)
+
+			for _, config := range benchConfigs {
+				codec := config.codec
+
+				compressed, err := codec.Encode(input)
+				if err != nil {
+					return err
+				}
+
+				encode := measure(len(input), func() { codec.Encode(input) })
+				decode := measure(len(input), func() { codec.Decode(compressed) })
+
+				name := fmt.Sprintf("%s/%dK/%s", profile.name, size/1024, config.name)
+				ratio := float64(len(compressed)) / float64(len(input))
+
+				fmt.Fprintf(w, "Encode/%-24s %s\n", name, encode)
+				fmt.Fprintf(w, "Decode/%-24s %s ratio %.3f\n", name, decode, ratio)
+			}
+		}
+	}
+
+	return nil
+}
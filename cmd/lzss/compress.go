@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/satinxs/lzss_rosetta/lzss"
+)
+
+// Parses flags given before, between or after the file names, which flag.Parse stops at, and
+// returns the file names
+func parseInterspersed(set *flag.FlagSet, arguments []string) []string {
+	var names []string
+	for {
+		set.Parse(arguments)
+		if set.NArg() == 0 {
+			return names
+		}
+
+		names = append(names, set.Arg(0))
+		arguments = set.Args()[1:]
+	}
+}
+
+// Reads the named file, or stdin for ""
+func readInput(name string) ([]byte, error) {
+	if name == "" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(name)
+}
+
+// Writes the named file, or stdout for ""
+func writeOutput(name string, data []byte) error {
+	if name == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	return os.WriteFile(name, data, 0o644)
+}
+
+// Returns the codec for the -offsetbits, -lengthbits and -minlen flags, validated by lzss.New
+func newCodec(offsetBits, lengthBits, minimumLength uint) (lzss.Lzss, error) {
+	//Out of range values must fail validation rather than wrap around
+	return lzss.New(
+		lzss.WithOffsetBits(byte(min(offsetBits, math.MaxUint8))),
+		lzss.WithLengthBits(byte(min(lengthBits, math.MaxUint8))),
+		lzss.WithMinimumLength(uint32(min(minimumLength, math.MaxUint32))),
+	)
+}
+
+// Compresses input to output with a self-describing header holding the parameters, so
+// decompress needs none of them
+func compress(codec lzss.Lzss, input, output string) error {
+	data, err := readInput(input)
+	if err != nil {
+		return err
+	}
+
+	codec.SelfDescribing = true
+	compressed, err := codec.Encode(data)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(output, compressed)
+}
+
+func decompress(input, output string) error {
+	data, err := readInput(input)
+	if err != nil {
+		return err
+	}
+
+	decompressed, err := lzss.DecodeAuto(data)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(output, decompressed)
+}
+
+// Prints err to stderr and exits with status 1
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "lzss: %s\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,175 @@
+// Command lzss compresses and decompresses files with the Go port, round-trips a file through
+// it, or checks the encoder output against a conformance vector.
+//
+//	lzss -c [input] [-o output]  compress, reading stdin and writing stdout by default
+//	lzss -d [input] [-o output]  decompress a stream written by -c
+//	lzss <input>                 encode and decode input with Verify, failing if the bytes differ
+//	lzss <input> <expected>      fail unless input encodes to exactly expected
+//	lzss -bench <text>           benchmark Encode and Decode on random, repetitive and text input
+//
+// -c takes -offsetbits, -lengthbits and -minlen, and stores them in the stream for -d.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/satinxs/lzss_rosetta/lzss"
+)
+
+func checkConformance(l lzss.Lzss, input, expected []byte) error {
+	compressed, err := l.Encode(input)
+	if err != nil {
+		return err
+	}
+
+	if len(compressed) != len(expected) {
+		return fmt.Errorf("Compressed length %d does not match expected %d", len(compressed), len(expected))
+	}
+
+	for i, b := range compressed {
+		if b != expected[i] {
+			return fmt.Errorf("Compressed byte at %d does not match!", i)
+		}
+	}
+
+	uncompressed, err := l.Decode(expected)
+	if err != nil {
+		return err
+	}
+
+	if len(uncompressed) != len(input) {
+		return fmt.Errorf("Decoded length %d does not match input %d", len(uncompressed), len(input))
+	}
+
+	for i, b := range uncompressed {
+		if b != input[i] {
+			return fmt.Errorf("Decoded byte at %d does not match!", i)
+		}
+	}
+
+	return nil
+}
+
+// Returns an OnProgress callback logging to w at most once per interval, plus the final call
+func newProgressLogger(w io.Writer, interval time.Duration) func(done, total, written uint32) {
+	start := time.Now()
+	last := start
+
+	return func(done, total, written uint32) {
+		now := time.Now()
+		if now.Sub(last) < interval && done < total {
+			return
+		}
+		last = now
+
+		elapsed := now.Sub(start).Seconds()
+		throughput, ratio := 0.0, 0.0
+		if elapsed > 0 {
+			throughput = float64(done) / elapsed / 1e6
+		}
+		if done > 0 {
+			ratio = float64(written) / float64(done)
+		}
+
+		fmt.Fprintf(w, "%.1fs %d/%d bytes %.2f MB/s ratio %.3f\n", elapsed, done, total, throughput, ratio)
+	}
+}
+
+func main() {
+	verbose := flag.Bool("verbose", false, "log compression progress to stderr")
+	bench := flag.Bool("bench", false, "benchmark the codec, using the input as the text profile")
+	compressMode := flag.Bool("c", false, "compress the input (stdin if none) to -o")
+	decompressMode := flag.Bool("d", false, "decompress the input (stdin if none) to -o")
+	output := flag.String("o", "", "output file for -c and -d, stdout if empty")
+	offsetBits := flag.Uint("offsetbits", 10, "offset width in bits for -c, the window is 2^bits-1 bytes")
+	lengthBits := flag.Uint("lengthbits", 6, "length width in bits for -c")
+	minimumLength := flag.Uint("minlen", 2, "shortest match for -c")
+	args := parseInterspersed(flag.CommandLine, os.Args[1:])
+
+	if *compressMode || *decompressMode {
+		if *compressMode && *decompressMode {
+			fail(errors.New("-c and -d can't be used together"))
+		}
+		if len(args) > 1 {
+			fail(errors.New("-c and -d take at most one input file"))
+		}
+
+		input := ""
+		if len(args) == 1 {
+			input = args[0]
+		}
+
+		var err error
+		if *decompressMode {
+			err = decompress(input, *output)
+		} else {
+			var codec lzss.Lzss
+			codec, err = newCodec(*offsetBits, *lengthBits, *minimumLength)
+			if err == nil {
+				if *verbose {
+					codec.OnProgress = newProgressLogger(os.Stderr, time.Second)
+				}
+				err = compress(codec, input, *output)
+			}
+		}
+
+		if err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	if len(args) != 1 && len(args) != 2 {
+		fail(errors.New("Was expecting a filename as argument"))
+	}
+
+	fileName := args[0]
+
+	input, err := os.ReadFile(fileName)
+	if err != nil {
+		panic(err)
+	}
+
+	if *bench {
+		err = runBenchmarks(os.Stdout, input)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	codec := lzss.NewLzss(10, 6, 2)
+
+	//With a second argument we check the encoder output byte-for-byte against a conformance vector
+	if len(args) == 2 {
+		expected, err := os.ReadFile(args[1])
+		if err != nil {
+			panic(err)
+		}
+
+		err = checkConformance(codec, input, expected)
+		if err != nil {
+			fmt.Printf("%s: %s\n", args[1], err)
+			os.Exit(-1)
+		}
+		return
+	}
+
+	if *verbose {
+		codec.OnProgress = newProgressLogger(os.Stderr, time.Second)
+	}
+
+	err = codec.Verify(input)
+	if errors.Is(err, lzss.ErrRoundTrip) {
+		fmt.Printf("%s: %s\n", fileName, err)
+		os.Exit(-1)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satinxs/lzss_rosetta/lzss"
+)
+
+// Run as the command when the tests start it, see runCommand
+func TestMain(m *testing.M) {
+	if os.Getenv("LZSS_RUN_MAIN") == "1" {
+		os.Args = append([]string{"lzss"}, strings.Fields(os.Getenv("LZSS_ARGS"))...)
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// Runs the command with args in a process of its own, as it exits, returning its stdout and
+// exit status
+func runCommand(t *testing.T, stdin []byte, args ...string) ([]byte, int) {
+	t.Helper()
+
+	command := exec.Command(os.Args[0])
+	command.Env = append(os.Environ(), "LZSS_RUN_MAIN=1", "LZSS_ARGS="+strings.Join(args, " "))
+	command.Stdin = bytes.NewReader(stdin)
+
+	output, err := command.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return output, exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output, 0
+}
+
+func TestCompressDecompress(t *testing.T) {
+	input, err := os.ReadFile("../../corpus/grammar.lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	compressed, decompressed := filepath.Join(dir, "grammar.lz"), filepath.Join(dir, "grammar.lsp")
+
+	//Flags after the file name too, and parameters -d reads back from the stream
+	_, status := runCommand(t, nil, "-c", "../../corpus/grammar.lsp", "-o", compressed, "-offsetbits", "12", "-lengthbits", "4", "-minlen", "3")
+	if status != 0 {
+		t.Fatalf("-c exited with %d", status)
+	}
+	_, status = runCommand(t, nil, "-d", compressed, "-o", decompressed)
+	if status != 0 {
+		t.Fatalf("-d exited with %d", status)
+	}
+
+	output, err := os.ReadFile(decompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, input) {
+		t.Error("-c and -d of a file don't round-trip")
+	}
+
+	//stdin to stdout
+	stream, status := runCommand(t, input, "-c")
+	if status == 0 {
+		output, status = runCommand(t, stream, "-d")
+	}
+	if status != 0 || !bytes.Equal(output, input) {
+		t.Errorf("-c and -d through stdin and stdout exited with %d, round-trip %v", status, bytes.Equal(output, input))
+	}
+}
+
+func TestBadArguments(t *testing.T) {
+	garbage := filepath.Join(t.TempDir(), "garbage.lz")
+	err := os.WriteFile(garbage, []byte("not a stream"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invocations := map[string][]string{
+		"unknown flag":       {"-x"},
+		"-c and -d":          {"-c", "-d"},
+		"two inputs":         {"-c", "a", "b"},
+		"offset bits of 40":  {"-c", "-offsetbits", "40"},
+		"minimum length 0":   {"-c", "-minlen", "0"},
+		"missing input":      {"-c", "does-not-exist"},
+		"corrupt stream":     {"-d", garbage},
+		"no file":            {},
+		"three files":        {"a", "b", "c"},
+		"flag without value": {"-o"},
+	}
+
+	for name, args := range invocations {
+		_, status := runCommand(t, []byte("input"), args...)
+		if status == 0 {
+			t.Errorf("%s: %v exited with 0", name, args)
+		}
+	}
+}
+
+func TestProgressLogger(t *testing.T) {
+	input := bytes.Repeat([]byte("a large input of repeated text, "), 64*1024)
+
+	var log bytes.Buffer
+	codec := lzss.NewLzss(10, 6, 2)
+	codec.OnProgress = newProgressLogger(&log, time.Hour)
+
+	_, err := codec.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Rate-limited to the final call, which always logs
+	lines := strings.Split(strings.TrimSuffix(log.String(), "\n"), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], "2097152/2097152 bytes") {
+		t.Errorf("logged %q, want one line for the whole input", log.String())
+	}
+
+	log.Reset()
+	codec.OnProgress = newProgressLogger(&log, 0)
+
+	_, err = codec.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Count(log.String(), "\n") < 2 {
+		t.Errorf("logged %q without a rate limit, want a line per progress call", log.String())
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/satinxs/lzss_rosetta
+
+go 1.23
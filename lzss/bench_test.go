@@ -0,0 +1,304 @@
+package lzss
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Compress and Decompress into buffers big enough for them, which should never allocate
+func BenchmarkCodec(b *testing.B) {
+	input := readCorpus(b, "alice29.txt")[:16*1024]
+	codec := NewCodec(NewLzss(10, 6, 2))
+
+	compressed := make([]byte, codec.Lzss.GetUpperBound(uint32(len(input))))
+	decompressed := make([]byte, len(input))
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i += 1 {
+		output, err := codec.Compress(compressed, input)
+		if err == nil {
+			_, err = codec.Decompress(decompressed, output)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Encode of a large text with a large window, by each way of finding matches, reporting the
+// compressed size as a fraction of the input
+func BenchmarkFinders(b *testing.B) {
+	input := readCorpus(b, "lcet10.txt")
+
+	finders := map[string]func(l *Lzss) MatchFinder{
+		"hashchain":   func(l *Lzss) MatchFinder { return nil },
+		"tree":        (*Lzss).NewTreeFinder,
+		"suffixarray": (*Lzss).NewSuffixArrayFinder,
+	}
+
+	for name, newFinder := range finders {
+		b.Run(name, func(b *testing.B) {
+			l := NewLzss(16, 8, 3)
+			l.Finder = newFinder(&l)
+
+			compressed, err := l.Encode(input)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(int64(len(input)))
+			b.ReportMetric(float64(len(compressed))/float64(len(input)), "ratio")
+			for i := 0; i < b.N; i += 1 {
+				l.Encode(input)
+			}
+		})
+	}
+}
+
+// Encode of 1 MB of text with the hash chain and with the window scan it replaced
+func BenchmarkHashChain(b *testing.B) {
+	text := readCorpus(b, "lcet10.txt")
+	input := bytes.Repeat(text, 1<<20/len(text)+1)[:1<<20]
+
+	for _, name := range []string{"scan", "hashchain"} {
+		b.Run(name, func(b *testing.B) {
+			l := NewLzss(10, 6, 2)
+			if name == "scan" {
+				l.Finder = l.NewScanFinder()
+			}
+
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i += 1 {
+				l.Encode(input)
+			}
+		})
+	}
+}
+
+// Decoding many small blocks with Decode, which allocates every output, and DecodeInto or
+// DecodeBuffer a reused buffer, which don't; see -benchmem
+func BenchmarkDecodeInto(b *testing.B) {
+	input := readCorpus(b, "alice29.txt")[:4096]
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.Encode(input)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("Decode", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i += 1 {
+			l.Decode(compressed)
+		}
+	})
+
+	b.Run("DecodeInto", func(b *testing.B) {
+		dst := make([]byte, len(input))
+
+		b.SetBytes(int64(len(input)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i += 1 {
+			dst, _ = l.DecodeInto(compressed, dst)
+		}
+	})
+
+	b.Run("DecodeBuffer", func(b *testing.B) {
+		var buf bytes.Buffer
+
+		b.SetBytes(int64(len(input)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i += 1 {
+			buf.Reset()
+			l.DecodeBuffer(compressed, &buf)
+		}
+	})
+}
+
+// EncodeParallel against Encode of the same input, which gains with the number of CPUs
+func BenchmarkEncodeParallel(b *testing.B) {
+	input := bytes.Repeat(readCorpus(b, "lcet10.txt"), 10)
+	l := NewLzss(12, 4, 2)
+	l.ParallelBlockSize = 512 * 1024
+
+	encoders := map[string]func([]byte) ([]byte, error){"serial": l.Encode, "parallel": l.EncodeParallel}
+	for name, encode := range encoders {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i += 1 {
+				encode(input)
+			}
+		})
+	}
+}
+
+// Decode of matches that don't overlap their source, copied at once, and of runs that do,
+// copied a byte at a time
+func BenchmarkDecodeMatches(b *testing.B) {
+	l := NewLzss(10, 8, 2)
+	inputs := map[string][]byte{
+		"disjoint":    bytes.Repeat(getRandomInput(1000, 8), 1000),
+		"overlapping": bytes.Repeat([]byte("abc"), 1000000/3),
+	}
+
+	for name, input := range inputs {
+		compressed, err := l.Encode(input)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			output := make([]byte, len(input))
+
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i += 1 {
+				l.DecodeInto(compressed, output)
+			}
+		})
+	}
+}
+
+// Encode of small inputs, which copies its output out of a pooled buffer, against encoding
+// into a new worst-case buffer each time as it did before; see -benchmem
+func BenchmarkEncodePool(b *testing.B) {
+	input := readCorpus(b, "alice29.txt")[:8192]
+	l := NewLzss(10, 6, 2)
+
+	b.Run("pooled", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i += 1 {
+			l.Encode(input)
+		}
+	})
+
+	b.Run("unpooled", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i += 1 {
+			l.EncodeTo(make([]byte, l.GetUpperBound(uint32(len(input)))), input)
+		}
+	})
+}
+
+type benchInput struct {
+	name  string
+	input []byte
+}
+
+// Incompressible, highly repetitive, run and text inputs of 64 KB and 1 MB
+func getBenchInputs(b *testing.B) []benchInput {
+	text := readCorpus(b, "plrabn12.txt")
+	profiles := []benchInput{
+		{"random", getRandomInput(1<<20, 9)},
+		{"repetitive", bytes.Repeat([]byte("abcdefgh"), 1<<20/8)},
+		{"zeros", make([]byte, 1<<20)},
+		{"text", bytes.Repeat(text, 1<<20/len(text)+1)},
+	}
+
+	var inputs []benchInput
+	for _, profile := range profiles {
+		inputs = append(inputs, benchInput{profile.name + "/64K", profile.input[:64*1024]})
+		inputs = append(inputs, benchInput{profile.name + "/1M", profile.input[:1<<20]})
+	}
+
+	return inputs
+}
+
+// A small window with long matches, a large one with short matches, and the same with the
+// binary tree instead of the hash chain
+func getBenchConfigs() []struct {
+	name string
+	l    Lzss
+} {
+	tree := NewLzss(14, 4, 3)
+	tree.Finder = tree.NewTreeFinder()
+
+	return []struct {
+		name string
+		l    Lzss
+	}{
+		{"10,6,2", NewLzss(10, 6, 2)},
+		{"14,4,3", NewLzss(14, 4, 3)},
+		{"14,4,3/tree", tree},
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, input := range getBenchInputs(b) {
+		for _, config := range getBenchConfigs() {
+			b.Run(input.name+"/"+config.name, func(b *testing.B) {
+				b.SetBytes(int64(len(input.input)))
+				for i := 0; i < b.N; i += 1 {
+					_, err := config.l.Encode(input.input)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, input := range getBenchInputs(b) {
+		for _, config := range getBenchConfigs() {
+			//The finder only changes which matches are found, not how they decode
+			if config.l.Finder != nil {
+				continue
+			}
+
+			compressed, err := config.l.Encode(input.input)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.Run(input.name+"/"+config.name, func(b *testing.B) {
+				b.SetBytes(int64(len(input.input)))
+				for i := 0; i < b.N; i += 1 {
+					_, err := config.l.Decode(compressed)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Encode with the window scan, carrying lengths forward between adjacent positions and
+// comparing every candidate again, by a greedy parse and an optimal one that searches every
+// position. Carrying pays on repetitive input and should cost nothing on English text
+func BenchmarkScanFinder(b *testing.B) {
+	inputs := []benchInput{
+		{"text", readCorpus(b, "alice29.txt")[:16*1024]},
+		{"repetitive", bytes.Repeat(getRandomInput(300, 10), 20)},
+	}
+
+	finders := []struct {
+		name      string
+		newFinder func(l *Lzss) MatchFinder
+	}{
+		{"carried", (*Lzss).NewScanFinder},
+		{"plain", newPlainScanFinder},
+	}
+
+	for _, input := range inputs {
+		for _, optimal := range []bool{false, true} {
+			for _, finder := range finders {
+				b.Run(input.name+ternary(optimal, "/optimal/", "/greedy/")+finder.name, func(b *testing.B) {
+					l := NewLzss(12, 4, 2)
+					l.Optimal = optimal
+					l.Finder = finder.newFinder(&l)
+
+					b.SetBytes(int64(len(input.input)))
+					for i := 0; i < b.N; i += 1 {
+						l.Encode(input.input)
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package lzss
+
+import "math"
+
+// No position, for the tree links and roots
+const treeEmpty = math.MaxUint32
+
+// treeFinder keeps the positions of the window in binary search trees ordered by the bytes
+// that follow them, like LZMA's bt match finders. The longest match for index is next to it in
+// that order, so inserting index finds it along the way, in about log2(window) comparisons
+// instead of a walk over every position with the same key. There is one tree per key of the
+// first keyLength bytes, as for the hash chain, so on incompressible input the trees stay
+// small and most inserts compare nothing.
+//
+// Each insert makes index the root and splits the old tree around it, so every node is
+// newer than the nodes below it, positions that left the window are only found at the bottom,
+// and of equal length matches the closest is visited first.
+type treeFinder struct {
+	l *Lzss
+
+	//The input being indexed, to notice when FindMatch moves on to another
+	base   *byte
+	length int
+
+	roots     []uint32 //By key, the newest position with that key
+	children  []uint32 //By position modulo len(children)/2, the smaller and the larger subtree
+	keyLength uint32
+	inserted  uint32 //Positions before this are in the trees
+}
+
+// NewTreeFinder returns a MatchFinder backed by binary trees of the window, which finds the
+// longest match up to maximumLength as the scan does. It is much faster than the built-in hash
+// chain on repetitive input, as fast on incompressible input, and slower on text. It holds
+// 8 bytes per window position and a 256 KB table of roots, and is not safe for concurrent use,
+// so it can't be used with EncodeParallel.
+//
+// With NoOverlap the longest match that fits before index may be off the path through the
+// tree, so it can return shorter matches than the scan.
+func (l *Lzss) NewTreeFinder() MatchFinder {
+	return &treeFinder{l: l}
+}
+
+func (f *treeFinder) FindMatch(input []byte, index uint32) Match {
+	if index >= uint32(len(input)) {
+		return Match{}
+	}
+
+	if &input[0] != f.base || len(input) != f.length || index < f.inserted {
+		f.reset(input, index)
+	}
+
+	for f.inserted < index {
+		f.insert(input, f.inserted)
+		f.inserted += 1
+	}
+
+	f.inserted += 1
+	return f.insert(input, index)
+}
+
+// Reset forgets the input being indexed, keeping the tables, so the next FindMatch starts
+// over even on the same buffer with new contents.
+func (f *treeFinder) Reset() {
+	f.base, f.length = nil, 0
+}
+
+// Starts over with empty trees for input, where the positions up to maxOffset before index
+// can be matched
+func (f *treeFinder) reset(input []byte, index uint32) {
+	l := f.l
+
+	//A position is only overwritten once it is more than maxOffset back, or never if the
+	//whole input fits
+	size := uint32(1)
+	for size <= l.maxOffset && size < uint32(len(input)) {
+		size <<= 1
+	}
+
+	if uint32(cap(f.children)) < 2*size {
+		f.children = make([]uint32, 2*size)
+	}
+
+	f.keyLength = min(l.minimumLength, 3)
+	rootCount := ternary(f.keyLength == 0, 1, hashChainHeadSize)
+	if len(f.roots) != rootCount {
+		f.roots = make([]uint32, rootCount)
+	}
+
+	//Every link is written when its position is inserted, before it can be followed
+	f.children = f.children[:2*size]
+	for i := range f.roots {
+		f.roots[i] = treeEmpty
+	}
+
+	f.base, f.length = &input[0], len(input)
+	f.inserted = ternary(l.maxOffset > index, 0, index-l.maxOffset)
+}
+
+// Inserts position index as the root of its tree, returning the longest match it was
+// compared with
+func (f *treeFinder) insert(input []byte, index uint32) Match {
+	l := f.l
+	mask := uint32(len(f.children)/2 - 1)
+	noOverlap := l.noOverlap()
+
+	//Too close to the end for a key, and so for any match starting here or from here
+	if uint32(len(input))-index < f.keyLength {
+		return Match{}
+	}
+
+	//Comparing past the longest match the stream holds gains nothing, so a node matching up
+	//to there is replaced by index
+	lengthLimit := min(uint32(len(input))-index, l.getMaximumMatchLength())
+
+	//Where the next node smaller and larger than index is linked, and how many bytes all
+	//nodes on either side are known to share with index
+	smaller, larger := 2*(index&mask), 2*(index&mask)+1
+	smallerLength, largerLength := uint32(0), uint32(0)
+
+	best := Match{}
+	key := getHashKey(input, index, f.keyLength)
+	node := f.roots[key]
+	f.roots[key] = index
+
+	for node != treeEmpty && index-node <= l.maxOffset && lengthLimit > 0 {
+		pair := 2 * (node & mask)
+
+		length := min(smallerLength, largerLength)
+		for length < lengthLimit && input[node+length] == input[index+length] {
+			length += 1
+		}
+
+		usable := ternary(noOverlap, min(length, index-node), length)
+		if usable > best.Length {
+			best = Match{Offset: index - node, Length: usable}
+		}
+
+		if length == lengthLimit {
+			//index orders the same as node as far as is ever compared, so it takes its place
+			f.children[smaller] = f.children[pair]
+			f.children[larger] = f.children[pair+1]
+			return best
+		}
+
+		if input[node+length] < input[index+length] {
+			f.children[smaller] = node
+			smaller = pair + 1
+			smallerLength = length
+			node = f.children[smaller]
+		} else {
+			f.children[larger] = node
+			larger = pair
+			largerLength = length
+			node = f.children[larger]
+		}
+	}
+
+	//What is left below is out of the window, or there is nothing to compare
+	f.children[smaller] = treeEmpty
+	f.children[larger] = treeEmpty
+
+	return best
+}
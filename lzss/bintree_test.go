@@ -0,0 +1,40 @@
+package lzss
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTreeFinder(t *testing.T) {
+	//The scan compares every candidate in a run up to its end, at every position, so runs
+	//are kept short
+	inputs := map[string][]byte{
+		"text":   readCorpus(t, "alice29.txt")[:6000],
+		"source": readCorpus(t, "grammar.lsp"),
+		"random": getRandomInput(3000, 5),
+		"runs":   bytes.Repeat([]byte("aaaaaaaaab"), 50),
+		"zeros":  make([]byte, 500),
+	}
+
+	for name, l := range getTestConfigs() {
+		for inputName, input := range inputs {
+			tree, scan := l.NewTreeFinder(), newPlainScanFinder(&l)
+
+			//Every position, not only those the parse searches, each the longest match up to
+			//maximumLength or none below minimumLength
+			for index := uint32(0); index < uint32(len(input)); index += 1 {
+				found, expected := tree.FindMatch(input, index), scan.FindMatch(input, index)
+				found.Length = ternary(found.Length < l.minimumLength, 0, found.Length)
+				expected.Length = ternary(expected.Length < l.minimumLength, 0, expected.Length)
+
+				if found.Length != expected.Length {
+					t.Fatalf("%s/%s: the tree found %d bytes at %d, the scan %d", name, inputName, found.Length, index, expected.Length)
+				}
+
+				if found.Length > 0 && (found.Offset == 0 || found.Offset > min(index, l.maxOffset) || !bytes.Equal(input[index-found.Offset:][:found.Length], input[index:][:found.Length])) {
+					t.Fatalf("%s/%s: the tree's match at %d, %d bytes %d back, is not one", name, inputName, index, found.Length, found.Offset)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package lzss
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+type bitStream struct {
+	buffer         []byte
+	bufferLength   uint32
+	bufferPosition uint32
+	byteBuffer     byte
+	bitCount       byte
+
+	lsbFirst bool //See Lzss.LSBFirst
+}
+
+func (l *Lzss) newBitStream(buffer []byte) bitStream {
+	stream := bitStream{lsbFirst: l.LSBFirst}
+	stream.reset(buffer)
+	return stream
+}
+
+// Starts over at the first bit of buffer, dropping any bits not flushed yet
+func (b *bitStream) reset(buffer []byte) {
+	b.buffer = buffer
+	b.bufferLength = uint32(len(buffer))
+	b.bufferPosition = 0
+	b.byteBuffer = 0
+	b.bitCount = 0
+}
+
+// Errors for malformed streams, to tell apart with errors.Is. Decode wraps them with the
+// token and bit where they were found.
+var (
+	ErrCorrupt       = errors.New("Stream is corrupt")
+	ErrUnexpectedEOF = io.ErrUnexpectedEOF //The stream ends before the data it declares
+	ErrShortBuffer   = errors.New("Buffer is too small for the output")
+)
+
+func (b *bitStream) unflush() error {
+	if b.bufferPosition < b.bufferLength {
+		b.byteBuffer = b.buffer[b.bufferPosition]
+		b.bufferPosition += 1
+		b.bitCount = 8
+
+		return nil
+	}
+
+	return ErrUnexpectedEOF
+}
+
+func (b *bitStream) flush() error {
+	if b.bitCount == 0 {
+		return nil
+	}
+
+	//Left-justify a partial byte, LSB first its bits already are
+	if b.bitCount < 8 && !b.lsbFirst {
+		b.byteBuffer <<= (8 - b.bitCount)
+	}
+
+	if b.bufferPosition >= b.bufferLength {
+		return ErrShortBuffer
+	}
+
+	b.buffer[b.bufferPosition] = b.byteBuffer
+	b.bufferPosition += 1
+	b.byteBuffer = 0
+	b.bitCount = 0
+
+	return nil
+}
+
+func (b *bitStream) readBit() (bool, error) {
+	if b.lsbFirst {
+		return b.readBitLSB()
+	}
+
+	return b.readBitMSB()
+}
+
+func (b *bitStream) readBitMSB() (bool, error) {
+	if b.bitCount == 0 {
+		err := b.unflush()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	b.bitCount -= 1
+	return (b.byteBuffer & (1 << b.bitCount)) > 0, nil
+}
+
+func (b *bitStream) readBitLSB() (bool, error) {
+	if b.bitCount == 0 {
+		err := b.unflush()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	bit := (b.byteBuffer & (1 << (8 - b.bitCount))) > 0
+	b.bitCount -= 1
+	return bit, nil
+}
+
+func (b *bitStream) writeBit(bit bool) error {
+	if b.lsbFirst {
+		return b.writeBitLSB(bit)
+	}
+
+	return b.writeBitMSB(bit)
+}
+
+func (b *bitStream) writeBitMSB(bit bool) error {
+	b.byteBuffer <<= 1
+	b.byteBuffer |= ternary[byte](bit, 1, 0)
+
+	b.bitCount += 1
+	if b.bitCount == 8 {
+		return b.flush()
+	}
+
+	return nil
+}
+
+func (b *bitStream) writeBitLSB(bit bool) error {
+	b.byteBuffer |= ternary[byte](bit, 1, 0) << b.bitCount
+
+	b.bitCount += 1
+	if b.bitCount == 8 {
+		return b.flush()
+	}
+
+	return nil
+}
+
+var (
+	ErrFieldTooWide  = errors.New("Bit field is wider than 32 bits")
+	ErrFieldOverflow = errors.New("Value does not fit its bit field")
+)
+
+// Fields are read and written most significant bit first, or least significant first with
+// lsbFirst. The two orders are separate loops, since this is the hot path of both directions.
+// Wider fields would shift bits off the top of the uint32, so they fail instead
+func (b *bitStream) readUint32(bits byte) (uint32, error) {
+	if bits > 32 {
+		return 0, ErrFieldTooWide
+	}
+
+	if b.lsbFirst {
+		return b.readUint32LSB(bits)
+	}
+
+	value := uint32(0)
+
+	for i := byte(0); i < bits; i += 1 {
+		value <<= 1
+		bit, err := b.readBitMSB()
+		if err != nil {
+			return 0, err
+		}
+		value |= ternary[uint32](bit, 1, 0)
+	}
+
+	return value, nil
+}
+
+func (b *bitStream) readUint32LSB(bits byte) (uint32, error) {
+	value := uint32(0)
+
+	for i := byte(0); i < bits; i += 1 {
+		bit, err := b.readBitLSB()
+		if err != nil {
+			return 0, err
+		}
+		value |= ternary[uint32](bit, 1, 0) << i
+	}
+
+	return value, nil
+}
+
+// Values that need more than bits bits fail rather than lose their high bits
+func (b *bitStream) writeUint32(number uint32, bits byte) error {
+	if bits > 32 {
+		return ErrFieldTooWide
+	}
+
+	if bits < 32 && number>>bits != 0 {
+		return fmt.Errorf("%w: %d in %d bits", ErrFieldOverflow, number, bits)
+	}
+
+	if b.lsbFirst {
+		return b.writeUint32LSB(number, bits)
+	}
+
+	for bits > 0 {
+		mask := uint32(1 << (bits - 1))
+		bit := (number & mask) > 0
+
+		err := b.writeBitMSB(bit)
+		if err != nil {
+			return err
+		}
+
+		bits -= 1
+	}
+
+	return nil
+}
+
+func (b *bitStream) writeUint32LSB(number uint32, bits byte) error {
+	for i := byte(0); i < bits; i += 1 {
+		err := b.writeBitLSB((number>>i)&1 != 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Bits read so far, counting from the start of buffer
+func (b *bitStream) getBitsRead() uint64 {
+	return 8*uint64(b.bufferPosition) - uint64(b.bitCount)
+}
+
+// Reads a varint written by write7BitUint32, failing on values above 32 bits
+func (b *bitStream) read7BitUint32() (uint32, error) {
+	number, err := b.read7BitUint64()
+	if err != nil {
+		return 0, err
+	}
+
+	if number > math.MaxUint32 {
+		return 0, fmt.Errorf("%w: varint overflows 32 bits", ErrCorrupt)
+	}
+
+	return uint32(number), nil
+}
+
+func (b *bitStream) write7BitUint32(number uint32) error {
+	return b.write7BitUint64(uint64(number))
+}
+
+// Reads an unsigned LEB128 varint of up to 10 bytes
+func (b *bitStream) read7BitUint64() (uint64, error) {
+	number := uint64(0)
+
+	for shift := uint32(0); shift < 64; shift += 7 {
+		by, err := b.readUint32(8)
+		if err != nil {
+			return 0, err
+		}
+
+		//The 10th byte only has room for the top bit
+		if shift == 63 && by > 1 {
+			return 0, fmt.Errorf("%w: varint overflows 64 bits", ErrCorrupt)
+		}
+
+		number |= uint64(by&127) << shift
+
+		if (by & 128) == 0 {
+			return number, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: varint overflows 64 bits", ErrCorrupt)
+}
+
+// Writes number as an unsigned LEB128 varint, except that 0 is written as nothing at all
+func (b *bitStream) write7BitUint64(number uint64) error {
+	//127 = 7 bits
+	for number > 127 {
+		by := 128 | uint32(number&127) //Set the first bit as 1
+		err := b.writeUint32(by, 8)
+		if err != nil {
+			return err
+		}
+
+		number >>= 7
+	}
+
+	if number > 0 {
+		return b.writeUint32(uint32(number), 8)
+	}
+
+	return nil
+}
+
+// Number of bytes write7BitUint32 uses for number
+func get7BitLength(number uint32) uint32 {
+	length := uint32(0)
+
+	for number > 127 {
+		length += 1
+		number >>= 7
+	}
+
+	return ternary[uint32](number > 0, length+1, length)
+}
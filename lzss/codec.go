@@ -0,0 +1,76 @@
+package lzss
+
+import "errors"
+
+// Codec bundles a configured Lzss with a reusable encode scratch buffer for hot paths. A Codec
+// is not safe for concurrent use.
+//
+// Buffer ownership: Compress and Decompress never retain src or dst. The returned slice
+// aliases dst when dst has enough capacity, and is a new allocation owned by the caller
+// otherwise. It never aliases the Codec's own scratch buffer.
+type Codec struct {
+	Lzss Lzss
+
+	scratch []byte
+}
+
+// NewCodec returns a Codec for lzss with no scratch buffer yet.
+func NewCodec(lzss Lzss) *Codec {
+	return &Codec{Lzss: lzss}
+}
+
+// Compress encodes src into dst. It does not allocate if cap(dst) is at least
+// GetUpperBound(len(src)); otherwise it encodes into the scratch buffer and returns an
+// exactly-sized copy. Like Encode it honours FailIncompressible, and MaxEncodeMemory, which
+// bounds the scratch buffer in place of the worst case.
+func (c *Codec) Compress(dst, src []byte) ([]byte, error) {
+	if len(src) == 0 {
+		return dst[:0], nil
+	}
+
+	output, err := c.compress(dst, src)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Lzss.FailIncompressible && len(output) >= len(src) {
+		return nil, ErrIncompressible
+	}
+
+	return output, nil
+}
+
+func (c *Codec) compress(dst, src []byte) ([]byte, error) {
+	upperBound := c.Lzss.getEncodeBufferLength(uint32(len(src)), 0)
+	if uint64(cap(dst)) >= upperBound {
+		return c.Lzss.encodeTo(dst[:upperBound], src, nil)
+	}
+
+	//As in EncodeStats, the output goes straight into a buffer of at most the limit, as the
+	//copy out of the scratch buffer would need it twice
+	if c.Lzss.MaxEncodeMemory != 0 {
+		output, err := c.Lzss.encodeTo(make([]byte, min(upperBound, uint64(c.Lzss.MaxEncodeMemory))), src, nil)
+		if errors.Is(err, ErrShortBuffer) {
+			return nil, ErrMemoryLimitExceeded
+		}
+
+		return output, err
+	}
+
+	if uint64(cap(c.scratch)) < upperBound {
+		c.scratch = make([]byte, upperBound)
+	}
+
+	output, err := c.Lzss.encodeTo(c.scratch[:upperBound], src, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), output...), nil
+}
+
+// Decompress decodes src into dst. It does not allocate if cap(dst) is at least the original
+// length (see GetOriginalLength).
+func (c *Codec) Decompress(dst, src []byte) ([]byte, error) {
+	return c.Lzss.decodeTo(dst, src, nil)
+}
@@ -0,0 +1,142 @@
+package lzss
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The vectors the encoder must reproduce, as conformance_version in the Makefile. A change
+// to the produced bytes goes into a new testdata/conformance/vN directory, never into an
+// old one, and older versions must still decode.
+const conformanceVersion = "v2"
+
+type vector struct {
+	name     string
+	input    []byte
+	expected []byte
+}
+
+// Reads every .in file in dir with the .lz file next to it
+func readVectors(t testing.TB, dir string) []vector {
+	t.Helper()
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Fatalf("no vectors in %s", dir)
+	}
+
+	var vectors []vector
+	for _, name := range names {
+		input, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := os.ReadFile(strings.TrimSuffix(name, ".in") + ".lz")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vectors = append(vectors, vector{filepath.Base(name), input, expected})
+	}
+
+	return vectors
+}
+
+// Fails on the first byte where Encode drifts from expected, and unless expected decodes
+// back to input
+func checkVector(t *testing.T, l Lzss, v vector, encode bool) {
+	t.Helper()
+
+	if encode {
+		compressed, err := l.Encode(v.input)
+		if err != nil {
+			t.Fatalf("%s: Encode: %s", v.name, err)
+		}
+
+		if !bytes.Equal(compressed, v.expected) {
+			index := 0
+			for index < min(len(compressed), len(v.expected)) && compressed[index] == v.expected[index] {
+				index += 1
+			}
+			t.Errorf("%s: encoder output drifted at byte %d (%d bytes, expected %d)", v.name, index, len(compressed), len(v.expected))
+		}
+	}
+
+	decoded, err := l.Decode(v.expected)
+	if err != nil {
+		t.Fatalf("%s: Decode: %s", v.name, err)
+	}
+
+	err = checkRoundTrip(v.input, decoded)
+	if err != nil {
+		t.Errorf("%s: %s", v.name, err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	versions, err := filepath.Glob("../testdata/conformance/v*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, version := range versions {
+		current := filepath.Base(version) == conformanceVersion
+		found = found || current
+
+		for _, v := range readVectors(t, version) {
+			checkVector(t, NewLzss(10, 6, 2), v, current)
+		}
+	}
+
+	if !found {
+		t.Fatalf("no vectors for the current version %s", conformanceVersion)
+	}
+}
+
+// The rosetta vectors are what every port in the repo produces and reads
+func TestRosetta(t *testing.T) {
+	for _, v := range readVectors(t, "../testdata/rosetta") {
+		checkVector(t, NewLzss(10, 6, 2), v, true)
+	}
+}
+
+// BiasedLength is a format of its own, with vectors of its own, from NewLzss(10, 4, 3)
+func TestBiasedConformance(t *testing.T) {
+	l := NewLzss(10, 4, 3)
+	l.BiasedLength = true
+
+	for _, v := range readVectors(t, "../testdata/conformance/biased") {
+		checkVector(t, l, v, true)
+	}
+}
+
+// The vectors under testdata/okumura were written by Okumura's LZSS.C, kept beside them, which
+// EncodeOkumura must match byte for byte
+func TestOkumuraConformance(t *testing.T) {
+	for _, v := range readVectors(t, "../testdata/okumura") {
+		compressed := EncodeOkumura(v.input)
+		if !bytes.Equal(compressed, v.expected) {
+			index := 0
+			for index < min(len(compressed), len(v.expected)) && compressed[index] == v.expected[index] {
+				index += 1
+			}
+			t.Errorf("%s: EncodeOkumura drifted from LZSS.C at byte %d (%d bytes, expected %d)", v.name, index, len(compressed), len(v.expected))
+		}
+
+		decoded, err := DecodeOkumura(v.expected)
+		if err == nil {
+			err = checkRoundTrip(v.input, decoded)
+		}
+		if err != nil {
+			t.Errorf("%s: DecodeOkumura: %s", v.name, err)
+		}
+	}
+}
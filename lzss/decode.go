@@ -0,0 +1,554 @@
+package lzss
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"iter"
+	"math"
+)
+
+func (l *Lzss) readToken(stream *bitStream) (token, error) {
+	isPair, err := stream.readBit()
+	if err != nil {
+		return token{}, err
+	}
+
+	if isPair {
+		offset, err := stream.readUint32(l.offsetBits)
+		if err != nil {
+			return token{}, err
+		}
+		length, err := stream.readUint32(l.lengthBits)
+		if err != nil {
+			return token{}, err
+		}
+
+		return token{isPair: true, offset: offset, length: length + l.getLengthBias()}, nil
+	}
+
+	literal, err := stream.readUint32(8)
+	if err != nil {
+		return token{}, err
+	}
+
+	return token{literal: byte(literal), length: 1}, nil
+}
+
+var ErrInvalidBackReference = fmt.Errorf("%w: invalid back-reference", ErrCorrupt)
+
+// Checks that a token read from an untrusted stream can be written at index: a match must copy
+// from inside the output, no more than maxOffset back, and end by outputLength. Decoders that
+// only keep the last maxOffset bytes rely on the window check.
+func (t *token) check(index uint32, outputLength uint32, maxOffset uint32) error {
+	if !t.isPair {
+		return nil
+	}
+
+	if t.offset == 0 || t.offset > index {
+		return fmt.Errorf("%w: match at byte %d reaches %d bytes back", ErrInvalidBackReference, index, t.offset)
+	}
+
+	if t.offset > maxOffset {
+		return fmt.Errorf("%w: match at byte %d reaches %d bytes back, past the window of %d", ErrInvalidBackReference, index, t.offset, maxOffset)
+	}
+
+	if t.length > outputLength-index {
+		return fmt.Errorf("%w: match at byte %d copies %d bytes past the original length %d", ErrInvalidBackReference, index, t.length, outputLength)
+	}
+
+	return nil
+}
+
+// Checks that a stream of inputLength bytes can decode to originalLength bytes, before
+// allocating them. Every token takes at least a bit.
+func (l *Lzss) checkOriginalLength(originalLength uint32, inputLength uint32) error {
+	if uint64(originalLength) > 8*uint64(inputLength)*uint64(max(l.getMaximumLength(), 1)) {
+		return fmt.Errorf("%w: invalid length header", ErrCorrupt)
+	}
+
+	return nil
+}
+
+func (t *token) writeTo(output []byte, index uint32) {
+	if t.isPair && t.offset >= t.length {
+		//Disjoint source and destination
+		copy(output[index:index+t.length], output[index-t.offset:])
+	} else if t.isPair {
+		//Overlapping, each byte may be one this match just wrote
+		for i := uint32(0); i < t.length; i += 1 {
+			output[index+i] = output[(index-t.offset)+i]
+		}
+	} else {
+		output[index] = t.literal
+	}
+}
+
+var (
+	ErrTooManyTokens = errors.New("Stream has more tokens than MaxTokens")
+	ErrTrailingBits  = errors.New("Stream has nonzero padding bits")
+	ErrTrailingBytes = errors.New("Stream has bytes after the last token")
+)
+
+// Decode decompresses a stream produced by Encode with the same configuration.
+func (l *Lzss) Decode(input []byte) ([]byte, error) {
+	if len(input) == 0 {
+		return []byte{}, nil
+	}
+
+	return l.decodeTo(nil, input, nil)
+}
+
+// DecodeInto is Decode writing into dst, resliced to the original length, when dst has the
+// capacity for it, and into a new buffer otherwise. It returns the decoded slice.
+func (l *Lzss) DecodeInto(input, dst []byte) ([]byte, error) {
+	return l.decodeTo(dst, input, nil)
+}
+
+// DecodeTo decodes input into dst and returns the number of bytes written, the complement to
+// EncodeTo. Unlike DecodeInto it never allocates: a dst shorter than GetOriginalLength(input)
+// fails with ErrShortBuffer.
+func (l *Lzss) DecodeTo(dst []byte, input []byte) (int, error) {
+	if len(input) == 0 {
+		return 0, nil
+	}
+
+	originalLength, err := l.GetOriginalLength(input)
+	if err != nil {
+		return 0, err
+	}
+
+	if uint64(originalLength) > uint64(len(dst)) {
+		return 0, fmt.Errorf("%w: %d bytes needed, %d given", ErrShortBuffer, originalLength, len(dst))
+	}
+
+	output, err := l.decodeTo(dst[:0:len(dst)], input, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(output), nil
+}
+
+// DecodeWithLength is Decode, also returning the original length the header declares, read
+// in the same pass instead of again by GetOriginalLength. The length is returned even when
+// the tokens after the header fail to decode, and is 0 only if the header can't be read or
+// declares 0, as empty input does. On success it is len(output).
+func (l *Lzss) DecodeWithLength(input []byte) ([]byte, uint32, error) {
+	if len(input) == 0 {
+		return []byte{}, 0, nil
+	}
+
+	return l.decodeWithLength(nil, input, nil)
+}
+
+// DecodeString is Decode returning the decoded bytes as a string.
+func (l *Lzss) DecodeString(compressed []byte) (string, error) {
+	output, err := l.Decode(compressed)
+	if err != nil {
+		return "", err
+	}
+
+	return string(output), nil
+}
+
+// Decodes input into dst if it has enough capacity, allocating otherwise
+func (l *Lzss) decodeTo(dst []byte, input []byte, onToken func(token token)) ([]byte, error) {
+	if len(input) == 0 {
+		return dst[:0], nil
+	}
+
+	output, _, err := l.decodeWithLength(dst, input, onToken)
+	return output, err
+}
+
+// Like decodeTo for a non-empty input, also returning the original length once the header is
+// read, whether or not the tokens decode
+func (l *Lzss) decodeWithLength(dst []byte, input []byte, onToken func(token token)) ([]byte, uint32, error) {
+	inputLength := uint32(len(input))
+
+	stream := l.newBitStream(input)
+	originalLength, err := l.readHeader(&stream)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = l.checkOriginalLength(originalLength, inputLength)
+	if err != nil {
+		return nil, originalLength, err
+	}
+
+	var output []byte
+	if uint64(cap(dst)) >= uint64(originalLength) {
+		output = dst[:originalLength]
+	} else {
+		output = make([]byte, originalLength)
+	}
+
+	err = l.decodeTokens(&stream, output, 0, onToken)
+	if err != nil {
+		return nil, originalLength, err
+	}
+
+	return output, originalLength, nil
+}
+
+// Reads tokens from the rest of stream until output is full from index on, with output[:index]
+// as history, honouring MaxTokens and Trailing
+func (l *Lzss) decodeTokens(stream *bitStream, output []byte, index uint32, onToken func(token token)) error {
+	originalLength := uint32(len(output))
+
+	for tokens := uint32(0); index < originalLength; tokens += 1 {
+		token, err := l.readCheckedToken(stream, index, originalLength, tokens)
+		if err != nil {
+			return err
+		}
+
+		if onToken != nil {
+			onToken(token)
+		}
+
+		token.writeTo(output, index)
+		index += token.length
+	}
+
+	return l.checkTrailing(stream)
+}
+
+// Reads the token at index of an output of originalLength bytes, after tokens others,
+// honouring MaxTokens
+func (l *Lzss) readCheckedToken(stream *bitStream, index uint32, originalLength uint32, tokens uint32) (token, error) {
+	if l.MaxTokens != 0 && tokens >= l.MaxTokens {
+		return token{}, ErrTooManyTokens
+	}
+
+	bitsRead := stream.getBitsRead()
+	next, err := l.readToken(stream)
+	if err == nil {
+		err = next.check(index, originalLength, l.maxOffset)
+	}
+	if err != nil {
+		return token{}, fmt.Errorf("%w (token %d at bit %d)", err, tokens, bitsRead)
+	}
+
+	return next, nil
+}
+
+func (l *Lzss) checkTrailing(stream *bitStream) error {
+	//The unread bits are the low ones, or the high ones LSB first
+	padding := ternary(stream.lsbFirst, stream.byteBuffer>>(8-stream.bitCount), stream.byteBuffer&(1<<stream.bitCount-1))
+	if l.Trailing >= TrailingZeroPadding && padding != 0 {
+		return ErrTrailingBits
+	}
+
+	if l.Trailing >= TrailingExactEnd && stream.bufferPosition < stream.bufferLength {
+		return ErrTrailingBytes
+	}
+
+	return nil
+}
+
+var (
+	ErrLengthMismatch   = errors.New("Length does not match the expected length")
+	ErrChecksumMismatch = errors.New("Checksum does not match the expected checksum")
+)
+
+// DecodeExpect decodes input only if it holds exactly expectedLen bytes whose IEEE CRC-32
+// is expectedCRC, returning ErrLengthMismatch or ErrChecksumMismatch otherwise.
+func (l *Lzss) DecodeExpect(input []byte, expectedLen uint32, expectedCRC uint32) ([]byte, error) {
+	//Check the declared length before doing any work
+	if len(input) > 0 {
+		originalLength, err := l.GetOriginalLength(input)
+		if err != nil {
+			return nil, err
+		}
+
+		if originalLength != expectedLen {
+			return nil, ErrLengthMismatch
+		}
+	}
+
+	output, err := l.Decode(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if uint32(len(output)) != expectedLen {
+		return nil, ErrLengthMismatch
+	}
+
+	if crc32.ChecksumIEEE(output) != expectedCRC {
+		return nil, ErrChecksumMismatch
+	}
+
+	return output, nil
+}
+
+const decodeChunkSize = 32 * 1024
+
+// DecodeCallback decodes input without building the whole output, passing emit chunks of
+// decoded bytes in order. A chunk is only valid until emit returns. Decoding stops at the
+// first error emit returns, which is passed back to the caller. It holds the window, one
+// longest match and decodeChunkSize more bytes, or the whole output if that is smaller, and
+// honours MaxTokens and Trailing as Decode does.
+func (l *Lzss) DecodeCallback(input []byte, emit func(chunk []byte) error) error {
+	if len(input) == 0 {
+		return nil
+	}
+
+	stream := l.newBitStream(input)
+	originalLength, err := l.readHeader(&stream)
+	if err != nil {
+		return err
+	}
+
+	err = l.checkOriginalLength(originalLength, uint32(len(input)))
+	if err != nil {
+		return err
+	}
+
+	//Room for the window, one longest match, and a chunk worth of new output, which can be
+	//more than 4 GiB with 31 bit offsets and lengths
+	size := min(uint64(l.maxOffset)+uint64(l.getMaximumLength())+decodeChunkSize, uint64(originalLength))
+	if size > math.MaxInt {
+		return fmt.Errorf("%w: invalid length header", ErrCorrupt)
+	}
+
+	buffer := make([]byte, size)
+	position := uint32(0)
+	emitted := uint32(0)
+
+	for index, tokens := uint32(0), uint32(0); index < originalLength; tokens += 1 {
+		//Offsets are checked against maxOffset, which the window holds, but the buffer is checked
+		//too so no stream can index before it
+		token, err := l.readCheckedToken(&stream, index, originalLength, tokens)
+		if err != nil {
+			return err
+		}
+
+		if uint64(position)+uint64(token.length) > size {
+			err = emit(buffer[emitted:position])
+			if err != nil {
+				return err
+			}
+
+			//Slide the window to the front, only the last maxOffset bytes can be referenced
+			kept := ternary(position > l.maxOffset, l.maxOffset, position)
+			copy(buffer, buffer[position-kept:position])
+			position = kept
+			emitted = kept
+		}
+
+		if token.offset > position {
+			return fmt.Errorf("%w: match at byte %d reaches %d bytes back, before the window (token %d)", ErrInvalidBackReference, index, token.offset, tokens)
+		}
+
+		token.writeTo(buffer, position)
+		position += token.length
+		index += token.length
+	}
+
+	err = l.checkTrailing(&stream)
+	if err != nil {
+		return err
+	}
+
+	return emit(buffer[emitted:position])
+}
+
+var errStopDecoding = errors.New("Stop decoding")
+
+// DecodeSeq yields the decoded bytes of input in order, then a final zero byte with the error
+// if decoding fails. Breaking out of the loop stops decoding, wasting at most one chunk of
+// decodeChunkSize bytes.
+func (l *Lzss) DecodeSeq(input []byte) iter.Seq2[byte, error] {
+	return func(yield func(byte, error) bool) {
+		err := l.DecodeCallback(input, func(chunk []byte) error {
+			for _, b := range chunk {
+				if !yield(b, nil) {
+					return errStopDecoding
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil && err != errStopDecoding {
+			yield(0, err)
+		}
+	}
+}
+
+var ErrNonCanonical = errors.New("Stream is not what this encoder would produce")
+
+// CanonicalDecode decodes input and re-encodes the output, rejecting with ErrNonCanonical any
+// valid stream that differs from the canonical encoding (different match choices, padding
+// bits or trailing bytes), so content and compressed form map one-to-one.
+func (l *Lzss) CanonicalDecode(input []byte) ([]byte, error) {
+	output, err := l.Decode(input)
+	if err != nil {
+		return nil, err
+	}
+
+	//The canonical encoding of nothing is nothing, not a header declaring zero bytes
+	if len(output) == 0 {
+		if len(input) > 0 {
+			return nil, ErrNonCanonical
+		}
+		return output, nil
+	}
+
+	//Re-encode quietly, the observers are only interested in real encodes
+	encoder := *l
+	encoder.Metrics = nil
+	encoder.OnProgress = nil
+
+	canonical, err := encoder.encodeTo(make([]byte, encoder.getEncodeBufferLength(uint32(len(output)), 0)), output, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(canonical, input) {
+		return nil, ErrNonCanonical
+	}
+
+	return output, nil
+}
+
+var ErrRoundTrip = errors.New("Decoded output does not match the input")
+
+// Verify encodes and decodes input, returning an error wrapping ErrRoundTrip with the first
+// byte that differs and both lengths if the output isn't input again, or nil if it is. A quick
+// check of a new Finder or configuration on sample data.
+func (l *Lzss) Verify(input []byte) error {
+	compressed, err := l.Encode(input)
+	if err != nil {
+		return err
+	}
+
+	output, err := l.Decode(compressed)
+	if err != nil {
+		return err
+	}
+
+	return checkRoundTrip(input, output)
+}
+
+// A length mismatch is reported at the end of the shorter one, if all bytes up to there match
+func checkRoundTrip(input, output []byte) error {
+	index := 0
+	for index < min(len(input), len(output)) && input[index] == output[index] {
+		index += 1
+	}
+
+	if index == len(input) && index == len(output) {
+		return nil
+	}
+
+	return fmt.Errorf("%w at byte %d (input %d bytes, output %d)", ErrRoundTrip, index, len(input), len(output))
+}
+
+// DecodeBuffer appends the decoded input to buf, decoding straight into its spare capacity so
+// a buf reused with Reset stops allocating once it is big enough.
+func (l *Lzss) DecodeBuffer(input []byte, buf *bytes.Buffer) error {
+	if len(input) == 0 {
+		return nil
+	}
+
+	originalLength, err := l.GetOriginalLength(input)
+	if err != nil {
+		return err
+	}
+
+	err = l.checkOriginalLength(originalLength, uint32(len(input)))
+	if err != nil {
+		return err
+	}
+
+	buf.Grow(int(originalLength))
+	output, err := l.decodeTo(buf.AvailableBuffer(), input, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.Write(output)
+	return err
+}
+
+// DecodeAt decodes the stream starting offset bytes into input, skipping any wrapper prefix
+// (e.g. an application magic) in front of the length header.
+func (l *Lzss) DecodeAt(input []byte, offset uint32) ([]byte, error) {
+	if uint64(offset) > uint64(len(input)) {
+		return nil, fmt.Errorf("Offset %d is past the end of the %d byte input", offset, len(input))
+	}
+
+	return l.Decode(input[offset:])
+}
+
+// GetInPlaceSize returns how big a buffer DecodeInPlace needs for a stream from Encode. Encode
+// only emits matches cheaper than their literals (see isUsable), so every stream it writes can
+// be decoded in place in a buffer this big, without an encode mode of its own.
+func (l *Lzss) GetInPlaceSize(compressed []byte) (uint32, error) {
+	originalLength, err := l.GetOriginalLength(compressed)
+	if err != nil {
+		return 0, err
+	}
+
+	//Every output byte costs at most 9 bits in an in-place stream, so the reader stays ahead
+	//of the writer as long as the buffer has an extra eighth of the output to spare
+	size := max(uint64(originalLength)+(uint64(originalLength)+7)/8, uint64(len(compressed)))
+	if size > math.MaxUint32 {
+		return 0, fmt.Errorf("%w: in-place buffer of %d bytes", ErrInputTooLarge, size)
+	}
+
+	return uint32(size), nil
+}
+
+// DecodeInPlace decodes the compressed stream stored in the last compressedLen bytes of buf
+// into the start of buf, overwriting the input as it goes, and returns the decoded slice. It
+// honours MaxTokens and Trailing as Decode does.
+func (l *Lzss) DecodeInPlace(buf []byte, compressedLen int) ([]byte, error) {
+	if compressedLen < 0 || compressedLen > len(buf) {
+		return nil, fmt.Errorf("%w: compressed length %d is not in 0..%d", ErrShortBuffer, compressedLen, len(buf))
+	}
+
+	if compressedLen == 0 {
+		return buf[:0], nil
+	}
+
+	base := uint32(len(buf) - compressedLen)
+	stream := l.newBitStream(buf[base:])
+	originalLength, err := l.readHeader(&stream)
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(originalLength) > uint64(len(buf)) {
+		return nil, fmt.Errorf("%w: %d bytes to decode in place in %d", ErrShortBuffer, originalLength, len(buf))
+	}
+	output := buf[:originalLength]
+
+	for index, tokens := uint32(0), uint32(0); index < originalLength; tokens += 1 {
+		token, err := l.readCheckedToken(&stream, index, originalLength, tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		//Bytes up to bufferPosition are already read, anything past it must not be overwritten.
+		//That never happens to a stream from Encode in GetInPlaceSize bytes
+		if index+token.length > base+stream.bufferPosition {
+			return nil, fmt.Errorf("%w: byte %d would overwrite unread input (token %d)", ErrShortBuffer, index, tokens)
+		}
+
+		token.writeTo(output, index)
+		index += token.length
+	}
+
+	err = l.checkTrailing(&stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
@@ -0,0 +1,458 @@
+package lzss
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"sync"
+)
+
+// ErrInputTooLarge is returned for inputs that don't fit the 32-bit length header. Larger
+// ones can be compressed with NewWriter, whose blocks each have their own header, or with
+// EncodeParallel.
+var ErrInputTooLarge = errors.New("Input is larger than 4 GiB")
+
+// Walks input making the same decisions Encode does, calling emit for every token
+func (l *Lzss) parse(input []byte, emit func(token token) error) error {
+	return l.parseFrom(input, 0, 0, emit)
+}
+
+// Like parseFrom, but emits the tokens with the fewest bits in total. Every length from
+// minimumLength up to the longest match at a position is a match there too, and all matches
+// cost the same, so the cheapest encoding of input[i:] is a literal or one of those lengths,
+// followed by the cheapest encoding of what is left. Computing that from the end backwards
+// costs up to maximumLength steps per byte on top of the match search, plus 20 bytes of memory
+// per input byte.
+func (l *Lzss) parseOptimal(input []byte, floor uint32, start uint32, emit func(token token) error) error {
+	count := uint32(len(input)) - start
+
+	//The finder only moves forward, so every match is found before any is chosen
+	finder := l.getMatchFinder(input, floor)
+	matches := make([]match, count)
+	for i := uint32(0); i < count; i += 1 {
+		if l.ctx != nil && i%cancelInterval == 0 {
+			err := l.ctx.Err()
+			if err != nil {
+				finder.release()
+				return err
+			}
+		}
+
+		matches[i] = l.getLongestMatch(input, floor, start+i, &finder)
+	}
+	finder.release()
+
+	//cost[i] is the fewest bits input[start+i:] encodes to, with a match of lengths[i] bytes
+	//first, or a literal for 0. Ties go to the literal, so a match is never taken unless it
+	//is cheaper than its literals
+	matchBits := 1 + uint64(l.offsetBits) + uint64(l.lengthBits)
+	cost := make([]uint64, count+1)
+	lengths := make([]uint32, count)
+	for i := int64(count) - 1; i >= 0; i -= 1 {
+		cost[i] = 9 + cost[i+1]
+
+		for length := max(l.minimumLength, 1); length <= matches[i].length; length += 1 {
+			if matchBits+cost[uint32(i)+length] < cost[i] {
+				cost[i] = matchBits + cost[uint32(i)+length]
+				lengths[i] = length
+			}
+		}
+	}
+
+	for i := uint32(0); i < count; {
+		var err error
+		if lengths[i] > 0 {
+			err = emit(token{isPair: true, offset: matches[i].offset, length: lengths[i]})
+			i += lengths[i]
+		} else {
+			err = emit(token{literal: input[start+i], length: 1})
+			i += 1
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Like parse, but starts at index and never matches before floor
+func (l *Lzss) parseFrom(input []byte, floor uint32, index uint32, emit func(token token) error) error {
+	//Positions are uint32, and so is the length in the header
+	if uint64(len(input)) > math.MaxUint32 {
+		return ErrInputTooLarge
+	}
+
+	if l.Optimal {
+		return l.parseOptimal(input, floor, index, emit)
+	}
+
+	inputLength := uint32(len(input))
+
+	finder := l.getMatchFinder(input, floor)
+	defer finder.release()
+
+	//With Lazy, the match already found at lookaheadIndex
+	lookahead, lookaheadIndex := match{}, inputLength
+
+	for index < inputLength {
+		found := lookahead
+		if lookaheadIndex != index {
+			found = l.getLongestMatch(input, floor, index, &finder)
+		}
+
+		if l.Lazy && l.isUsable(found) && index+1 < inputLength {
+			lookahead, lookaheadIndex = l.getLongestMatch(input, floor, index+1, &finder), index+1
+			if l.isUsable(lookahead) && lookahead.length > found.length {
+				found = match{}
+			}
+		}
+
+		if l.isUsable(found) {
+			err := emit(token{isPair: true, offset: found.offset, length: found.length})
+			if err != nil {
+				return err
+			}
+			index += found.length
+		} else {
+			err := emit(token{literal: input[index], length: 1})
+			if err != nil {
+				return err
+			}
+			index += 1
+		}
+	}
+
+	return nil
+}
+
+func (l *Lzss) getTokenBits(token token) uint64 {
+	return ternary(token.isPair, 1+uint64(l.offsetBits)+uint64(l.lengthBits), 1+8)
+}
+
+func (l *Lzss) writeToken(stream *bitStream, token token) error {
+	err := stream.writeBit(token.isPair) //We write a bit flagging whether this is a match
+	if err != nil {
+		return err
+	}
+
+	if token.isPair {
+		err = stream.writeUint32(token.offset, l.offsetBits)
+		if err != nil {
+			return err
+		}
+		return stream.writeUint32(token.length-l.getLengthBias(), l.lengthBits)
+	}
+
+	return stream.writeUint32(uint32(token.literal), 8)
+}
+
+// DryRunSize returns exactly len(Encode(input)) by making the same decisions as Encode
+// without writing any bits. Inputs over 4 GiB fail with ErrInputTooLarge, as they do in
+// Encode, rather than return the size of part of the input.
+func (l *Lzss) DryRunSize(input []byte) (uint32, error) {
+	inputLength := uint32(len(input))
+
+	if len(input) == 0 {
+		return 0, nil
+	}
+
+	totalBits := uint64(l.getHeaderLength(inputLength)) * 8
+
+	err := l.parse(input, func(token token) error {
+		totalBits += l.getTokenBits(token)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return uint32((totalBits + 7) / 8), nil
+}
+
+var (
+	ErrMemoryLimitExceeded = errors.New("Encoding needs more memory than MaxEncodeMemory")
+	ErrIncompressible      = errors.New("Input does not get smaller when encoded")
+)
+
+// Encode compresses input into a new buffer.
+func (l *Lzss) Encode(input []byte) ([]byte, error) {
+	output, _, err := l.EncodeStats(input)
+	return output, err
+}
+
+// EncodeContext is Encode, returning ctx.Err() once ctx is cancelled or its deadline passes.
+// The context is checked every few kilobytes of input.
+func (l *Lzss) EncodeContext(ctx context.Context, input []byte) ([]byte, error) {
+	encoder := *l
+	encoder.ctx = ctx
+
+	return encoder.Encode(input)
+}
+
+// Stats describes what EncodeStats did with its input. Literals+MatchedBytes is InputSize.
+type Stats struct {
+	Literals     uint32
+	Matches      uint32
+	MatchedBytes uint32 //Input bytes covered by matches
+
+	InputSize  uint32
+	OutputSize uint32
+	Ratio      float64 //OutputSize divided by InputSize, 0 for empty input
+}
+
+// EncodeStats is Encode, also returning how the input was split into literals and matches.
+func (l *Lzss) EncodeStats(input []byte) ([]byte, Stats, error) {
+	inputLength := uint32(len(input))
+	stats := Stats{InputSize: inputLength}
+
+	if len(input) == 0 {
+		return []byte{}, stats, nil
+	}
+
+	var output []byte
+	var err error
+
+	upperBound := l.getEncodeBufferLength(inputLength, 0)
+	if l.MaxEncodeMemory == 0 {
+		output, err = l.encodePooled(upperBound, input, &stats)
+	} else {
+		//A pooled buffer could be bigger than the limit, and copying the output out of it
+		//would need the output twice. If the worst case doesn't fit, the actual output still
+		//might
+		output, err = l.encodeTo(make([]byte, min(upperBound, uint64(l.MaxEncodeMemory))), input, &stats)
+		if errors.Is(err, ErrShortBuffer) {
+			return nil, Stats{}, ErrMemoryLimitExceeded
+		}
+	}
+
+	if err != nil {
+		return nil, Stats{}, err
+	}
+
+	if l.FailIncompressible && uint32(len(output)) >= inputLength {
+		return nil, Stats{}, ErrIncompressible
+	}
+
+	stats.OutputSize = uint32(len(output))
+	stats.Ratio = float64(stats.OutputSize) / float64(inputLength)
+
+	return output, stats, nil
+}
+
+// Scratch buffers up to this size are reused across Encode calls, larger ones are returned
+// to the caller as they are, since copying out the output would cost more than the allocation
+const maxPooledEncodeBuffer = 4 << 20
+
+var encodeBufferPool sync.Pool
+
+// Encodes a non-empty input into a scratch buffer of bufferLength bytes and returns a
+// right-sized copy of the output. The bitStream writes every byte it returns, so nothing a
+// previous encode left in the buffer reaches the copy.
+func (l *Lzss) encodePooled(bufferLength uint64, input []byte, stats *Stats) ([]byte, error) {
+	if bufferLength > maxPooledEncodeBuffer {
+		return l.encodeTo(make([]byte, bufferLength), input, stats)
+	}
+
+	scratch, _ := encodeBufferPool.Get().(*[]byte)
+	if scratch == nil {
+		scratch = new([]byte)
+	}
+	if uint64(cap(*scratch)) < bufferLength {
+		*scratch = make([]byte, bufferLength)
+	}
+
+	output, err := l.encodeTo((*scratch)[:bufferLength], input, stats)
+	if err == nil {
+		output = bytes.Clone(output)
+	}
+
+	encodeBufferPool.Put(scratch)
+	return output, err
+}
+
+// ExactCompressedSize returns the size of Encode(input), the tight complement to
+// GetUpperBound. It parses input like Encode does, so it costs about as much as the match
+// search, but writes nothing. It fails as DryRunSize does.
+func (l *Lzss) ExactCompressedSize(input []byte) (uint32, error) {
+	return l.DryRunSize(input)
+}
+
+// EncodeTo encodes input into dst and returns the number of bytes written. A dst of
+// ExactCompressedSize(input) bytes is filled exactly; a smaller one fails with ErrShortBuffer.
+func (l *Lzss) EncodeTo(dst []byte, input []byte) (int, error) {
+	inputLength := uint32(len(input))
+
+	if len(input) == 0 {
+		return 0, nil
+	}
+
+	output, err := l.encodeTo(dst, input, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if l.FailIncompressible && uint32(len(output)) >= inputLength {
+		return 0, ErrIncompressible
+	}
+
+	return len(output), nil
+}
+
+// EncodeAppend appends the Encode of input to dst and returns the extended slice. dst only
+// grows when its spare capacity is below GetUpperBound(len(input)), so a dst reused across
+// calls stops allocating once it is big enough. On error dst is returned unchanged.
+func (l *Lzss) EncodeAppend(dst, input []byte) ([]byte, error) {
+	if len(input) == 0 {
+		return dst, nil
+	}
+
+	upperBound := int(l.getEncodeBufferLength(uint32(len(input)), 0))
+	dst = slices.Grow(dst, upperBound)
+
+	output, err := l.encodeTo(dst[len(dst):len(dst)+upperBound], input, nil)
+	if err != nil {
+		return dst, err
+	}
+
+	if l.FailIncompressible && len(output) >= len(input) {
+		return dst, ErrIncompressible
+	}
+
+	return dst[:len(dst)+len(output)], nil
+}
+
+// Encodes a non-empty input into output, returning the used part of it
+func (l *Lzss) encodeTo(output []byte, input []byte, stats *Stats) ([]byte, error) {
+	stream := l.newBitStream(output)
+
+	err := l.writeHeader(&stream, uint32(len(input)))
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.encodeTokens(&stream, input, 0, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	//Return only the relevant slice
+	return output[:stream.bufferPosition], nil
+}
+
+// Writes the tokens of a non-empty input[index:] after whatever header stream already holds,
+// with input[:index] as history, counting them in stats unless it is nil
+func (l *Lzss) encodeTokens(stream *bitStream, input []byte, index uint32, stats *Stats) error {
+	inputLength := uint32(len(input)) - index
+
+	done := uint32(0)
+	nextProgress := uint32(progressInterval)
+	nextCancelCheck := uint32(0)
+
+	err := l.parseFrom(input, 0, index, func(token token) error {
+		if l.ctx != nil && done >= nextCancelCheck {
+			err := l.ctx.Err()
+			if err != nil {
+				return err
+			}
+			nextCancelCheck = done + cancelInterval
+		}
+
+		if l.onToken != nil {
+			l.onToken(token, index+done)
+		}
+
+		if token.isPair && l.Metrics != nil {
+			l.Metrics.Observe(MetricMatchLength, float64(token.length))
+			l.Metrics.Observe(MetricMatchOffset, float64(token.offset))
+		}
+
+		if stats != nil && token.isPair {
+			stats.Matches += 1
+			stats.MatchedBytes += token.length
+		} else if stats != nil {
+			stats.Literals += 1
+		}
+
+		done += token.length
+		if l.OnProgress != nil && done >= nextProgress {
+			l.OnProgress(done, inputLength, stream.bufferPosition)
+			nextProgress = done + progressInterval
+		}
+
+		return l.writeToken(stream, token)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = stream.flush()
+	if err != nil {
+		return err
+	}
+
+	if l.Metrics != nil {
+		l.Metrics.Observe(MetricRatio, float64(stream.bufferPosition)/float64(inputLength))
+	}
+
+	if l.OnProgress != nil {
+		l.OnProgress(inputLength, inputLength, stream.bufferPosition)
+	}
+
+	return nil
+}
+
+// EncodeWithBoundaries works like Encode, but no match crosses any of the sorted boundary
+// positions, neither by its source nor its length. Each segment between boundaries is compressed
+// independently of the others' content, and the result decodes with Decode.
+func (l *Lzss) EncodeWithBoundaries(input []byte, boundaries []uint32) ([]byte, error) {
+	inputLength := uint32(len(input))
+
+	if len(input) == 0 {
+		return []byte{}, nil
+	}
+
+	output := make([]byte, l.getEncodeBufferLength(inputLength, 0))
+	stream := l.newBitStream(output)
+
+	err := l.writeHeader(&stream, inputLength)
+	if err != nil {
+		return nil, err
+	}
+
+	start := uint32(0)
+	for i := 0; i <= len(boundaries); i += 1 {
+		end := inputLength
+		if i < len(boundaries) {
+			end = boundaries[i]
+		}
+
+		if end < start || end > inputLength {
+			return nil, errors.New("Boundaries must be sorted and within the input")
+		}
+
+		err = l.parseFrom(input[:end], start, start, func(token token) error {
+			return l.writeToken(&stream, token)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		start = end
+	}
+
+	err = stream.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return output[:stream.bufferPosition], nil
+}
+
+// EncodeString is Encode for the bytes of s, which need not be valid UTF-8.
+func (l *Lzss) EncodeString(s string) ([]byte, error) {
+	return l.Encode([]byte(s))
+}
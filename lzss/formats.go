@@ -0,0 +1,932 @@
+package lzss
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EncodeSplit works like Encode, but moves every literal byte into a separate byte-aligned
+// literals stream (e.g. for an external entropy coder). Use DecodeSplit to reassemble them.
+func (l *Lzss) EncodeSplit(input []byte) (tokens []byte, literals []byte, err error) {
+	inputLength := uint32(len(input))
+
+	if len(input) == 0 {
+		return []byte{}, []byte{}, nil
+	}
+
+	//Literals only cost their flag bit here, and every match is cheaper than its literals, so
+	//the tokens fit in Encode's bound
+	output := make([]byte, l.getEncodeBufferLength(inputLength, 0))
+	stream := l.newBitStream(output)
+	literals = []byte{}
+
+	err = l.writeHeader(&stream, inputLength)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = l.parse(input, func(token token) error {
+		if token.isPair {
+			return l.writeToken(&stream, token)
+		}
+
+		literals = append(literals, token.literal)
+		return stream.writeBit(false)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = stream.flush()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output[:stream.bufferPosition], literals, nil
+}
+
+// EncodeBytewise makes the same decisions as Encode but writes every token byte-aligned, for
+// the simplest possible decoders: a varint original length, then per token a flag byte
+// followed by either the literal byte (flag 0) or the varint offset and length (flag 1).
+// Varints are unsigned LEB128, as in encoding/binary.
+func (l *Lzss) EncodeBytewise(input []byte) ([]byte, error) {
+	if len(input) == 0 {
+		return []byte{}, nil
+	}
+
+	output := binary.AppendUvarint(make([]byte, 0, len(input)), uint64(len(input)))
+
+	err := l.parse(input, func(token token) error {
+		if token.isPair {
+			output = append(output, 1)
+			output = binary.AppendUvarint(output, uint64(token.offset))
+			output = binary.AppendUvarint(output, uint64(token.length))
+		} else {
+			output = append(output, 0, token.literal)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// DecodeBytewise decodes the output of EncodeBytewise.
+func (l *Lzss) DecodeBytewise(input []byte) ([]byte, error) {
+	if len(input) == 0 {
+		return []byte{}, nil
+	}
+
+	originalLength, n := binary.Uvarint(input)
+	if n <= 0 || originalLength > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: invalid length header", ErrCorrupt)
+	}
+	input = input[n:]
+
+	err := l.checkOriginalLength(uint32(originalLength), uint32(len(input)))
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]byte, 0, originalLength)
+
+	for uint64(len(output)) < originalLength {
+		if len(input) < 2 {
+			return nil, ErrUnexpectedEOF
+		}
+
+		if input[0] > 1 {
+			return nil, fmt.Errorf("%w: token flag %d at byte %d", ErrCorrupt, input[0], len(output))
+		}
+
+		if input[0] == 0 {
+			output = append(output, input[1])
+			input = input[2:]
+			continue
+		}
+
+		offset, n := binary.Uvarint(input[1:])
+		if n <= 0 {
+			return nil, getUvarintError(n)
+		}
+		input = input[1+n:]
+
+		length, n := binary.Uvarint(input)
+		if n <= 0 {
+			return nil, getUvarintError(n)
+		}
+		input = input[n:]
+
+		if offset == 0 || offset > uint64(len(output)) || length > originalLength-uint64(len(output)) || length > uint64(l.getMaximumLength()) {
+			return nil, ErrInvalidBackReference
+		}
+
+		start := len(output) - int(offset)
+		for i := 0; i < int(length); i += 1 {
+			output = append(output, output[start+i])
+		}
+	}
+
+	return output, nil
+}
+
+// Shortest zero run EncodeSparse takes out of the dense data
+const sparseMinimumRun = 32
+
+// The error for a binary.Uvarint result n <= 0: 0 for a truncated varint, negative for one
+// that overflows 64 bits
+func getUvarintError(n int) error {
+	if n == 0 {
+		return ErrUnexpectedEOF
+	}
+
+	return fmt.Errorf("%w: varint overflows 64 bits", ErrCorrupt)
+}
+
+// EncodeSparse takes every run of at least sparseMinimumRun zero bytes out of input and
+// encodes the rest with Encode, for sparse data where plain LZSS pays a token per
+// maximumLength zeros. The output is a varint run count, per run the varint number of dense
+// bytes before it and its varint length, then the Encode of the dense bytes.
+func (l *Lzss) EncodeSparse(input []byte) ([]byte, error) {
+	var runs []uint64
+	dense := make([]byte, 0, len(input))
+
+	for index := 0; index < len(input); {
+		end := index
+		for end < len(input) && input[end] == 0 {
+			end += 1
+		}
+
+		if end-index >= sparseMinimumRun {
+			runs = append(runs, uint64(len(dense)), uint64(end-index))
+			index = end
+		} else {
+			dense = append(dense, input[index])
+			index += 1
+		}
+	}
+
+	output := binary.AppendUvarint(nil, uint64(len(runs)/2))
+	previous := uint64(0)
+	for i := 0; i < len(runs); i += 2 {
+		output = binary.AppendUvarint(output, runs[i]-previous)
+		output = binary.AppendUvarint(output, runs[i+1])
+		previous = runs[i]
+	}
+
+	encoded, err := l.Encode(dense)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(output, encoded...), nil
+}
+
+// DecodeSparse decodes the output of EncodeSparse.
+func (l *Lzss) DecodeSparse(input []byte) ([]byte, error) {
+	count, n := binary.Uvarint(input)
+	if n <= 0 {
+		return nil, getUvarintError(n)
+	}
+	input = input[n:]
+
+	//Most runs a header of this size can hold, every run takes at least two bytes
+	if count > uint64(len(input))/2 {
+		return nil, ErrUnexpectedEOF
+	}
+
+	runs := make([]uint64, 0, 2*count)
+	outputLength, zeros := uint64(0), uint64(0)
+	for i := uint64(0); i < count; i += 1 {
+		gap, n := binary.Uvarint(input)
+		if n <= 0 {
+			return nil, getUvarintError(n)
+		}
+		input = input[n:]
+
+		length, n := binary.Uvarint(input)
+		if n <= 0 {
+			return nil, getUvarintError(n)
+		}
+		input = input[n:]
+
+		//Checked one by one, since the sum of three 64-bit values can wrap
+		if gap > math.MaxUint32 || length > math.MaxUint32 || outputLength+gap+length > math.MaxUint32 {
+			return nil, fmt.Errorf("%w: invalid length header", ErrCorrupt)
+		}
+
+		runs = append(runs, gap, length)
+		outputLength += gap + length
+		zeros += length
+	}
+
+	dense, err := l.Decode(input)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]byte, 0, zeros+uint64(len(dense)))
+	for i := 0; i < len(runs); i += 2 {
+		gap, length := runs[i], runs[i+1]
+		if gap > uint64(len(dense)) {
+			return nil, fmt.Errorf("%w: zero run %d starts past the dense data", ErrCorrupt, i/2)
+		}
+
+		output = append(output, dense[:gap]...)
+		output = append(output, make([]byte, length)...)
+		dense = dense[gap:]
+	}
+
+	return append(output, dense...), nil
+}
+
+// EncodeFrames encodes every input as a stream of its own, for archives of several payloads.
+// The output is a varint frame count, then per frame the varint length of its stream and the
+// stream, so a reader can skip the frames it doesn't need without decoding them.
+func (l *Lzss) EncodeFrames(inputs [][]byte) ([]byte, error) {
+	output := binary.AppendUvarint(nil, uint64(len(inputs)))
+	for _, input := range inputs {
+		encoded, err := l.Encode(input)
+		if err != nil {
+			return nil, err
+		}
+
+		output = binary.AppendUvarint(output, uint64(len(encoded)))
+		output = append(output, encoded...)
+	}
+
+	return output, nil
+}
+
+// Returns the streams of the frames in the output of EncodeFrames, ignoring any bytes after
+// the last one
+func getFrames(input []byte) ([][]byte, error) {
+	count, n := binary.Uvarint(input)
+	if n <= 0 {
+		return nil, getUvarintError(n)
+	}
+	input = input[n:]
+
+	//Most frames a header of this size can hold, every frame takes at least a byte
+	if count > uint64(len(input)) {
+		return nil, ErrUnexpectedEOF
+	}
+
+	frames := make([][]byte, 0, count)
+	for i := uint64(0); i < count; i += 1 {
+		length, n := binary.Uvarint(input)
+		if n <= 0 {
+			return nil, getUvarintError(n)
+		}
+		if length > uint64(len(input)-n) {
+			return nil, fmt.Errorf("%w in frame %d", ErrUnexpectedEOF, i)
+		}
+
+		frames = append(frames, input[n:n+int(length)])
+		input = input[n+int(length):]
+	}
+
+	return frames, nil
+}
+
+// DecodeFrames decodes every frame of the output of EncodeFrames, in order.
+func (l *Lzss) DecodeFrames(input []byte) ([][]byte, error) {
+	frames, err := getFrames(input)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([][]byte, len(frames))
+	for i, frame := range frames {
+		outputs[i], err = l.Decode(frame)
+		if err != nil {
+			return nil, fmt.Errorf("Frame %d: %w", i, err)
+		}
+	}
+
+	return outputs, nil
+}
+
+// DecodeFrame decodes only frame index of the output of EncodeFrames, skipping the others by
+// their stored lengths.
+func (l *Lzss) DecodeFrame(input []byte, index int) ([]byte, error) {
+	frames, err := getFrames(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= len(frames) {
+		return nil, fmt.Errorf("Frame %d is not in 0..%d", index, len(frames)-1)
+	}
+
+	return l.Decode(frames[index])
+}
+
+// DecodeSplit reassembles the output of EncodeSplit. With TrailingExactEnd both streams
+// must end with the last token.
+func (l *Lzss) DecodeSplit(tokens []byte, literals []byte) ([]byte, error) {
+	if len(tokens) == 0 {
+		return []byte{}, nil
+	}
+
+	stream := l.newBitStream(tokens)
+	originalLength, err := l.readHeader(&stream)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.checkOriginalLength(originalLength, uint32(len(tokens)))
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]byte, originalLength)
+	literalIndex := 0
+
+	for index, tokens := uint32(0), uint32(0); index < originalLength; tokens += 1 {
+		if l.MaxTokens != 0 && tokens >= l.MaxTokens {
+			return nil, ErrTooManyTokens
+		}
+
+		isPair, err := stream.readBit()
+		if err != nil {
+			return nil, err
+		}
+
+		if isPair {
+			offset, err := stream.readUint32(l.offsetBits)
+			if err != nil {
+				return nil, err
+			}
+			length, err := stream.readUint32(l.lengthBits)
+			if err != nil {
+				return nil, err
+			}
+			length += l.getLengthBias()
+
+			token := token{isPair: true, offset: offset, length: length}
+			err = token.check(index, originalLength, l.maxOffset)
+			if err != nil {
+				return nil, err
+			}
+
+			token.writeTo(output, index)
+			index += length
+		} else {
+			if literalIndex >= len(literals) {
+				return nil, ErrUnexpectedEOF
+			}
+			output[index] = literals[literalIndex]
+			literalIndex += 1
+			index += 1
+		}
+	}
+
+	err = l.checkTrailing(&stream)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Trailing >= TrailingExactEnd && literalIndex < len(literals) {
+		return nil, ErrTrailingBytes
+	}
+
+	return output, nil
+}
+
+// EncodeWithChecksum is Encode with the IEEE CRC-32 of input stored as a big-endian uint32
+// right after the length header, for DecodeWithChecksum to verify.
+func (l *Lzss) EncodeWithChecksum(input []byte) ([]byte, error) {
+	inputLength := uint32(len(input))
+
+	if len(input) == 0 {
+		return []byte{}, nil
+	}
+
+	output := make([]byte, l.getEncodeBufferLength(inputLength, 4))
+	stream := l.newBitStream(output)
+
+	err := l.writeHeader(&stream, inputLength)
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.writeUint32(crc32.ChecksumIEEE(input), 32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.encodeTokens(&stream, input, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return output[:stream.bufferPosition], nil
+}
+
+// DecodeWithChecksum decodes the output of EncodeWithChecksum, returning ErrChecksumMismatch
+// if the decoded bytes don't match the stored CRC-32.
+func (l *Lzss) DecodeWithChecksum(input []byte) ([]byte, error) {
+	if len(input) == 0 {
+		return []byte{}, nil
+	}
+
+	return l.decodeWithChecksumTo(nil, input)
+}
+
+// Like decodeTo, for the output of EncodeWithChecksum
+func (l *Lzss) decodeWithChecksumTo(dst []byte, input []byte) ([]byte, error) {
+	inputLength := uint32(len(input))
+
+	stream := l.newBitStream(input)
+	originalLength, err := l.readHeader(&stream)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.checkOriginalLength(originalLength, inputLength)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := stream.readUint32(32)
+	if err != nil {
+		return nil, err
+	}
+
+	var output []byte
+	if uint64(cap(dst)) >= uint64(originalLength) {
+		output = dst[:originalLength]
+	} else {
+		output = make([]byte, originalLength)
+	}
+
+	err = l.decodeTokens(&stream, output, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(output) != checksum {
+		return nil, ErrChecksumMismatch
+	}
+
+	return output, nil
+}
+
+// The part of dict a match can reach from the first byte after it
+func (l *Lzss) getDictHistory(dict []byte) []byte {
+	return dict[len(dict)-min(len(dict), int(l.maxOffset)):]
+}
+
+// EncodeWithDict is Encode with dict as history preceding input, so matches can reach back
+// into it. Only its last maxOffset bytes are used. The output is an Encode stream of input,
+// but only DecodeWithDict with the same dict can decode it.
+func (l *Lzss) EncodeWithDict(input []byte, dict []byte) ([]byte, error) {
+	inputLength := uint32(len(input))
+
+	if len(input) == 0 {
+		return []byte{}, nil
+	}
+
+	history := l.getDictHistory(dict)
+	window := append(append(make([]byte, 0, len(history)+len(input)), history...), input...)
+
+	output := make([]byte, l.getEncodeBufferLength(inputLength, 0))
+	stream := l.newBitStream(output)
+
+	err := l.writeHeader(&stream, inputLength)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.encodeTokens(&stream, window, uint32(len(history)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.FailIncompressible && stream.bufferPosition >= inputLength {
+		return nil, ErrIncompressible
+	}
+
+	return output[:stream.bufferPosition], nil
+}
+
+// DecodeWithDict decodes the output of EncodeWithDict with the same dict.
+func (l *Lzss) DecodeWithDict(input []byte, dict []byte) ([]byte, error) {
+	inputLength := uint32(len(input))
+
+	if len(input) == 0 {
+		return []byte{}, nil
+	}
+
+	stream := l.newBitStream(input)
+	originalLength, err := l.readHeader(&stream)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.checkOriginalLength(originalLength, inputLength)
+	if err != nil {
+		return nil, err
+	}
+
+	history := l.getDictHistory(dict)
+	if uint64(len(history))+uint64(originalLength) > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: invalid length header", ErrCorrupt)
+	}
+
+	output := make([]byte, len(history)+int(originalLength))
+	copy(output, history)
+
+	err = l.decodeTokens(&stream, output, uint32(len(history)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return output[len(history):], nil
+}
+
+// EncodeRaw is Encode without the header: only the tokens, for containers that store the
+// original length themselves. Decode it with DecodeRaw.
+func (l *Lzss) EncodeRaw(input []byte) ([]byte, error) {
+	inputLength := uint32(len(input))
+
+	if len(input) == 0 {
+		return []byte{}, nil
+	}
+
+	output := make([]byte, l.getEncodeBufferLength(inputLength, 0))
+	stream := l.newBitStream(output)
+
+	err := l.encodeTokens(&stream, input, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.FailIncompressible && stream.bufferPosition >= inputLength {
+		return nil, ErrIncompressible
+	}
+
+	return output[:stream.bufferPosition], nil
+}
+
+// DecodeRaw decodes the output of EncodeRaw, given the original length.
+func (l *Lzss) DecodeRaw(input []byte, originalLength uint32) ([]byte, error) {
+	inputLength := uint32(len(input))
+
+	err := l.checkOriginalLength(originalLength, inputLength)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]byte, originalLength)
+	stream := l.newBitStream(input)
+
+	err = l.decodeTokens(&stream, output, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+var ErrCheckpointMismatch = errors.New("Output does not match the checkpoint")
+
+// EncodeWithCheckpoints prefixes the stream with interval as a varint and, after the token
+// that reaches every multiple of interval output bytes, writes a 32 bit Adler-32 of the output
+// so far, and once more at the end. DecodeWithCheckpoints checks each one, so corruption is
+// caught within about interval bytes of where it happened. An interval of 0 writes none.
+func (l *Lzss) EncodeWithCheckpoints(input []byte, interval uint32) ([]byte, error) {
+	inputLength := uint32(len(input))
+
+	checkpoints := uint32(0)
+	if interval > 0 {
+		checkpoints = inputLength/interval + 1
+	}
+	output := make([]byte, l.getEncodeBufferLength(inputLength, binary.MaxVarintLen32+4*uint64(checkpoints)))
+	stream := l.newBitStream(output)
+
+	err := stream.write7BitUint32(interval)
+	if err != nil {
+		return nil, err
+	}
+
+	//write7BitUint32 writes nothing for 0
+	if interval == 0 {
+		err = stream.writeUint32(0, 8)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(input) == 0 {
+		return output[:stream.bufferPosition], nil
+	}
+
+	err = l.writeHeader(&stream, inputLength)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := adler32.New()
+	done, hashed, next := uint32(0), uint32(0), interval
+
+	err = l.parse(input, func(token token) error {
+		err := l.writeToken(&stream, token)
+		if err != nil {
+			return err
+		}
+
+		done += token.length
+		if interval == 0 || done < next {
+			return nil
+		}
+
+		hash.Write(input[hashed:done])
+		hashed, next = done, (done/interval+1)*interval
+
+		return stream.writeUint32(hash.Sum32(), 32)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	//One last checkpoint covers the tail
+	if interval > 0 && hashed < inputLength {
+		hash.Write(input[hashed:])
+		err = stream.writeUint32(hash.Sum32(), 32)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = stream.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	return output[:stream.bufferPosition], nil
+}
+
+// DecodeWithCheckpoints decodes the output of EncodeWithCheckpoints. A failed checkpoint
+// returns an error wrapping ErrCheckpointMismatch with the range of output bytes since the
+// previous one, where the corruption is. It honours MaxTokens and Trailing as Decode does.
+func (l *Lzss) DecodeWithCheckpoints(input []byte) ([]byte, error) {
+	stream := l.newBitStream(input)
+
+	interval, err := stream.read7BitUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if stream.bufferPosition == stream.bufferLength {
+		return []byte{}, nil
+	}
+
+	originalLength, err := l.readHeader(&stream)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.checkOriginalLength(originalLength, uint32(len(input)))
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]byte, originalLength)
+
+	hash := adler32.New()
+	hashed, next := uint32(0), interval
+
+	for index, tokens := uint32(0), uint32(0); index < originalLength; tokens += 1 {
+		token, err := l.readCheckedToken(&stream, index, originalLength, tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		token.writeTo(output, index)
+		index += token.length
+
+		if interval == 0 || (index < next && index < originalLength) {
+			continue
+		}
+
+		hash.Write(output[hashed:index])
+
+		checkpoint, err := stream.readUint32(32)
+		if err != nil {
+			return nil, err
+		}
+
+		if checkpoint != hash.Sum32() {
+			return nil, fmt.Errorf("%w: bytes %d to %d", ErrCheckpointMismatch, hashed, index)
+		}
+
+		hashed, next = index, (index/interval+1)*interval
+	}
+
+	err = l.checkTrailing(&stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+var ErrConfigMismatch = errors.New("Stream was encoded with a different configuration")
+
+// Fingerprint hashes every parameter that affects the stream format, so a stream can carry
+// it and be checked against the decoder's configuration.
+func (l *Lzss) Fingerprint() uint32 {
+	parameters := []byte{l.offsetBits, l.lengthBits}
+	parameters = binary.BigEndian.AppendUint32(parameters, l.minimumLength)
+
+	//Flags are only added when set, so fingerprints of the default format stay the same
+	if l.FixedLengthHeader {
+		parameters = append(parameters, 'F')
+	}
+	if l.BiasedLength {
+		parameters = append(parameters, 'B')
+	}
+	if l.SelfDescribing {
+		parameters = append(parameters, 'S')
+	}
+	if l.LSBFirst {
+		parameters = append(parameters, 'L')
+	}
+
+	return crc32.ChecksumIEEE(parameters)
+}
+
+// EncodeWithFingerprint prefixes the Encode output with the big-endian Fingerprint.
+func (l *Lzss) EncodeWithFingerprint(input []byte) ([]byte, error) {
+	compressed, err := l.Encode(input)
+	if err != nil {
+		return nil, err
+	}
+
+	output := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(compressed)), l.Fingerprint())
+	return append(output, compressed...), nil
+}
+
+// DecodeWithFingerprint decodes the output of EncodeWithFingerprint, returning
+// ErrConfigMismatch if it was encoded with a different configuration.
+func (l *Lzss) DecodeWithFingerprint(input []byte) ([]byte, error) {
+	if len(input) < 4 {
+		return nil, ErrUnexpectedEOF
+	}
+
+	if binary.BigEndian.Uint32(input) != l.Fingerprint() {
+		return nil, ErrConfigMismatch
+	}
+
+	return l.Decode(input[4:])
+}
+
+// The first byte of EncodeWithFallback output
+const (
+	fallbackCompressed = 0 //An Encode stream follows
+	fallbackStored     = 1 //The input follows as is
+)
+
+// EncodeWithFallback is Encode, but stores input as is when encoding doesn't make it smaller,
+// so incompressible data grows by a single byte at most. The output is a mode byte, then the
+// Encode stream or the raw input.
+func (l *Lzss) EncodeWithFallback(input []byte) ([]byte, error) {
+	encoder := *l
+	encoder.FailIncompressible = true
+
+	compressed, err := encoder.Encode(input)
+	if errors.Is(err, ErrIncompressible) {
+		output := append(make([]byte, 0, 1+len(input)), fallbackStored)
+		return append(output, input...), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	output := append(make([]byte, 0, 1+len(compressed)), fallbackCompressed)
+	return append(output, compressed...), nil
+}
+
+// DecodeWithFallback decodes the output of EncodeWithFallback.
+func (l *Lzss) DecodeWithFallback(input []byte) ([]byte, error) {
+	if len(input) == 0 {
+		return nil, ErrUnexpectedEOF
+	}
+
+	switch input[0] {
+	case fallbackCompressed:
+		return l.Decode(input[1:])
+	case fallbackStored:
+		return append([]byte{}, input[1:]...), nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown fallback mode %d", ErrCorrupt, input[0])
+}
+
+// FileHeader is the optional metadata stored by EncodeWithHeader, like gzip's FNAME/MTIME.
+type FileHeader struct {
+	Name    string
+	ModTime time.Time //Stored with second precision
+}
+
+const headerFlagMetadata = 1
+
+// EncodeWithHeader prefixes the Encode output with a flags byte and, when header is not nil,
+// the length-prefixed name and the big-endian uint64 Unix modification time.
+func (l *Lzss) EncodeWithHeader(input []byte, header *FileHeader) ([]byte, error) {
+	compressed, err := l.Encode(input)
+	if err != nil {
+		return nil, err
+	}
+
+	output := []byte{0}
+	if header != nil {
+		output[0] |= headerFlagMetadata
+		output = binary.AppendUvarint(output, uint64(len(header.Name)))
+		output = append(output, header.Name...)
+		output = binary.BigEndian.AppendUint64(output, uint64(header.ModTime.Unix()))
+	}
+
+	return append(output, compressed...), nil
+}
+
+// DecodeWithHeader decodes the output of EncodeWithHeader. The header is nil if none was stored.
+func (l *Lzss) DecodeWithHeader(input []byte) ([]byte, *FileHeader, error) {
+	if len(input) == 0 {
+		return nil, nil, ErrUnexpectedEOF
+	}
+
+	flags := input[0]
+	input = input[1:]
+
+	var header *FileHeader
+	if flags&headerFlagMetadata != 0 {
+		nameLength, n := binary.Uvarint(input)
+		if n <= 0 || nameLength > uint64(len(input)-n) || uint64(len(input)-n)-nameLength < 8 {
+			return nil, nil, ErrUnexpectedEOF
+		}
+		input = input[n:]
+
+		header = &FileHeader{Name: string(input[:nameLength])}
+		input = input[nameLength:]
+
+		header.ModTime = time.Unix(int64(binary.BigEndian.Uint64(input)), 0)
+		input = input[8:]
+	}
+
+	output, err := l.Decode(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output, header, nil
+}
+
+// CompressFile compresses the file at path, remembering its name and modification time.
+func (l *Lzss) CompressFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.EncodeWithHeader(input, &FileHeader{Name: info.Name(), ModTime: info.ModTime()})
+}
+
+// DecompressFile restores a CompressFile archive into dir under its stored name and
+// modification time, returning the path written.
+func (l *Lzss) DecompressFile(archive []byte, dir string) (string, error) {
+	output, header, err := l.DecodeWithHeader(archive)
+	if err != nil {
+		return "", err
+	}
+
+	//Never let a stored name point outside of dir
+	if header == nil || filepath.Base(header.Name) != header.Name || header.Name == "." || header.Name == ".." {
+		return "", errors.New("Archive does not carry a usable file name")
+	}
+
+	path := filepath.Join(dir, header.Name)
+	err = os.WriteFile(path, output, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return path, os.Chtimes(path, header.ModTime, header.ModTime)
+}
@@ -0,0 +1,62 @@
+package lzss
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// Seeds a fuzz target with the conformance vectors, their inputs or their streams, along with
+// the edge cases every encoder and decoder has to handle
+func addFuzzSeeds(f *testing.F, streams bool) {
+	versions, err := filepath.Glob("../testdata/conformance/v*")
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	for _, version := range versions {
+		for _, v := range readVectors(f, version) {
+			f.Add(ternary(streams, v.expected, v.input))
+		}
+	}
+
+	f.Add([]byte{})
+	f.Add([]byte{0})
+	f.Add([]byte{0xff})
+	f.Add(bytes.Repeat([]byte{'a'}, 1000))
+	f.Add(bytes.Repeat([]byte("abc"), 500))
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	addFuzzSeeds(f, false)
+	configs := getTestConfigs()
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		for name, l := range configs {
+			compressed, err := l.Encode(input)
+			if err != nil {
+				t.Fatalf("%s: Encode: %s", name, err)
+			}
+
+			output, err := l.Decode(compressed)
+			if err == nil {
+				err = checkRoundTrip(input, output)
+			}
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	addFuzzSeeds(f, true)
+	configs := getTestConfigs()
+
+	//Any bytes are a stream to some config, which must fail with an error rather than panic
+	f.Fuzz(func(t *testing.T, input []byte) {
+		for _, l := range configs {
+			_, _ = l.Decode(input)
+		}
+	})
+}
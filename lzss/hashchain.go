@@ -0,0 +1,167 @@
+package lzss
+
+import "sync"
+
+// Head table entries, keys of up to 2 bytes index it directly
+const hashChainHeadSize = 1 << 16
+
+// hashChain finds the same matches as the window scan without visiting every position: the
+// positions are chained by their first keyLength bytes, and only the chain of index is
+// searched. Every match of at least minimumLength starts with the same keyLength bytes as
+// index, so the longest one is always on that chain. Shorter ones may be missed, but those
+// are emitted as literals either way.
+type hashChain struct {
+	head []uint32 //By key, last position inserted plus 1, 0 for none
+	prev []uint32 //By position modulo len(prev), the previous position with the same key plus 1
+
+	keyLength uint32
+	inserted  uint32 //Positions before this are in the chains
+
+	//The last match found, whose length at a later index is known without comparing again
+	lastIndex, lastDistance, lastLength uint32
+
+	//input[runStart:runChecked] is a run of one byte value
+	runStart, runChecked uint32
+}
+
+var hashChainPool sync.Pool
+
+// Returns a chain for matches of at least minimumLength in input, with positions from floor
+// on, or nil if the scan should be used instead
+func (l *Lzss) getHashChain(input []byte, floor uint32) *hashChain {
+	if l.minimumLength == 0 || l.MaxEncodeMemory != 0 {
+		return nil
+	}
+
+	//A position is only overwritten once it is more than maxOffset back, or never if the
+	//whole input fits
+	prevLength := uint32(1)
+	for prevLength <= l.maxOffset && prevLength < uint32(len(input)) {
+		prevLength <<= 1
+	}
+
+	chain, _ := hashChainPool.Get().(*hashChain)
+	if chain == nil {
+		chain = &hashChain{head: make([]uint32, hashChainHeadSize)}
+	}
+	if uint32(cap(chain.prev)) < prevLength {
+		chain.prev = make([]uint32, prevLength)
+	}
+
+	clear(chain.head)
+	chain.prev = chain.prev[:prevLength]
+	chain.keyLength = min(l.minimumLength, 3)
+	chain.inserted = floor
+	chain.lastLength = 0
+	chain.runStart, chain.runChecked = floor, floor
+
+	return chain
+}
+
+func putHashChain(chain *hashChain) {
+	if chain != nil {
+		hashChainPool.Put(chain)
+	}
+}
+
+func (c *hashChain) getKey(input []byte, position uint32) uint32 {
+	return getHashKey(input, position, c.keyLength)
+}
+
+// The head table index of the keyLength bytes at position, 0 for a keyLength of 0
+func getHashKey(input []byte, position uint32, keyLength uint32) uint32 {
+	if keyLength == 0 {
+		return 0
+	}
+
+	key := uint32(input[position])
+	if keyLength >= 2 {
+		key = key<<8 | uint32(input[position+1])
+	}
+	if keyLength >= 3 {
+		key = (key<<8 | uint32(input[position+2])) * 2654435761 >> 16
+	}
+
+	return key
+}
+
+// Like findLongestMatch, input[index:] must hold at least keyLength bytes
+func (c *hashChain) findLongestMatch(input []byte, offset uint32, index uint32, noOverlap bool) (uint32, uint32) {
+	inputLength := uint32(len(input))
+	mask := uint32(len(c.prev) - 1)
+
+	for ; c.inserted < index; c.inserted += 1 {
+		key := c.getKey(input, c.inserted)
+		c.prev[c.inserted&mask] = c.head[key]
+		c.head[key] = c.inserted + 1
+	}
+
+	//Matches are compared past maximumLength, which on long runs costs more than the search.
+	//A match of L bytes at lastIndex is one of L-n bytes n positions later, at the same distance
+	knownDistance, knownLength := uint32(0), uint32(0)
+	if index > c.lastIndex && index-c.lastIndex < c.lastLength {
+		knownDistance, knownLength = c.lastDistance, c.lastLength-(index-c.lastIndex)
+	}
+
+	//Within a run every position matches up to the end of the run and no further, so once
+	//one of them is compared the rest of the run can be skipped, as they would only tie. That
+	//needs all of them on this chain, which they are if the run goes on for keyLength more bytes
+	for ; c.runChecked < index; c.runChecked += 1 {
+		if input[c.runChecked] != input[c.runStart] {
+			c.runStart = c.runChecked
+		}
+	}
+
+	inRun := !noOverlap && c.runStart < index
+	for i := uint32(0); inRun && i < c.keyLength; i += 1 {
+		inRun = input[index+i] == input[c.runStart]
+	}
+
+	bestOffset := uint32(0)
+	bestLength := uint32(0)
+	bestExact := false
+
+	//Closest first, so a tie keeps the closer match just like the scan
+	for next := c.head[c.getKey(input, index)]; next > offset; next = c.prev[(next-1)&mask] {
+		candidate := next - 1
+
+		maxLength := inputLength - index
+		limitedByOverlap := noOverlap && index-candidate < maxLength
+		if limitedByOverlap {
+			maxLength = index - candidate
+		}
+
+		length := uint32(0)
+		if index-candidate == knownDistance {
+			length = knownLength
+		} else {
+			//Only a longer match can win, and that one has to match at bestLength
+			if bestLength >= maxLength || input[candidate+bestLength] != input[index+bestLength] {
+				continue
+			}
+
+			for length < maxLength && input[candidate+length] == input[index+length] {
+				length += 1
+			}
+		}
+
+		if length > bestLength {
+			bestLength = length
+			bestOffset = candidate
+			//Cut short by noOverlap, it may be longer at a later index
+			bestExact = length < maxLength || !limitedByOverlap
+		}
+
+		//The chain link of a position before the window may already be reused
+		if inRun && candidate > c.runStart {
+			if c.runStart <= offset {
+				break
+			}
+			next = c.runStart + 1
+		}
+	}
+
+	c.lastIndex, c.lastDistance, c.lastLength = index, index-bestOffset, ternary(bestExact, bestLength, 0)
+
+	return bestOffset, bestLength
+}
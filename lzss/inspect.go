@@ -0,0 +1,192 @@
+package lzss
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Bottleneck encodes input with cfg and reports which parameter limits the ratio the most:
+// matches found beyond maxOffset, matches cut at maximumLength, or profitable matches shorter
+// than minimumLength. It searches the whole input at every position, so use it on samples.
+func Bottleneck(input []byte, cfg Lzss) string {
+	positions, matches := 0, 0
+	outOfWindow, capped, tooShort := 0, 0, 0
+
+	matchBits := cfg.getTokenBits(token{isPair: true})
+
+	index := uint32(0)
+	cfg.parse(input, func(token token) error {
+		positions += 1
+
+		_, windowLength := findLongestMatch(input, ternary(cfg.maxOffset > index, 0, index-cfg.maxOffset), index, cfg.noOverlap())
+		_, fullLength := findLongestMatch(input, 0, index, cfg.noOverlap())
+
+		if fullLength > windowLength && fullLength >= cfg.minimumLength {
+			outOfWindow += 1
+		}
+
+		if token.isPair {
+			matches += 1
+			if windowLength > cfg.getMaximumMatchLength() {
+				capped += 1
+			}
+		} else if windowLength > 0 && matchBits < 9*uint64(windowLength) {
+			tooShort += 1
+		}
+
+		index += token.length
+		return nil
+	})
+
+	percentage := func(count, total int) float64 {
+		return ternary(total == 0, 0, 100*float64(count)/float64(total))
+	}
+
+	windowPercentage := percentage(outOfWindow, positions)
+	cappedPercentage := percentage(capped, matches)
+	shortPercentage := percentage(tooShort, positions-matches)
+
+	if windowPercentage == 0 && cappedPercentage == 0 && shortPercentage == 0 {
+		return "no bottleneck"
+	}
+
+	if windowPercentage >= cappedPercentage && windowPercentage >= shortPercentage {
+		return fmt.Sprintf("maxOffset too small (%.1f%% of best matches out of window)", windowPercentage)
+	}
+
+	if cappedPercentage >= shortPercentage {
+		return fmt.Sprintf("maximumLength too small (%.1f%% of matches hit the cap)", cappedPercentage)
+	}
+
+	return fmt.Sprintf("minimumLength too high (%.1f%% of literals had a profitable shorter match)", shortPercentage)
+}
+
+// Token is one literal or match of a stream, for tools that inspect the parse.
+type Token struct {
+	IsPair  bool
+	Offset  uint32 //Distance back from the current position, 0 for literals
+	Length  uint32 //1 for literals
+	Literal byte
+	Index   uint32 //The current position, where the token's bytes start in the decoded output
+}
+
+func (t token) export(index uint32) Token {
+	return Token{IsPair: t.isPair, Offset: t.offset, Length: t.length, Literal: t.literal, Index: index}
+}
+
+// Tokens returns the tokens Encode would write for input.
+func (l *Lzss) Tokens(input []byte) []Token {
+	var tokens []Token
+
+	index := uint32(0)
+	l.parse(input, func(token token) error {
+		tokens = append(tokens, token.export(index))
+		index += token.length
+		return nil
+	})
+
+	return tokens
+}
+
+// EncodeTrace is Encode, also returning the tokens it wrote, to compare the parse of another
+// port against. The output is the same as Encode's.
+func (l *Lzss) EncodeTrace(input []byte) ([]byte, []Token, error) {
+	var tokens []Token
+
+	encoder := *l
+	encoder.onToken = func(token token, index uint32) {
+		tokens = append(tokens, token.export(index))
+	}
+
+	output, err := encoder.Encode(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output, tokens, nil
+}
+
+// DecodeWithTokens decodes input and also returns the tokens actually read from it, which may
+// differ from what Tokens returns if the stream came from another encoder.
+func (l *Lzss) DecodeWithTokens(input []byte) ([]byte, []Token, error) {
+	if len(input) == 0 {
+		return []byte{}, nil, nil
+	}
+
+	var tokens []Token
+
+	index := uint32(0)
+	output, err := l.decodeTo(nil, input, func(token token) {
+		tokens = append(tokens, token.export(index))
+		index += token.length
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return output, tokens, nil
+}
+
+const (
+	DumpLiteral byte = 0
+	DumpMatch   byte = 1
+)
+
+// DumpTokens writes the tokens of a compressed stream to w for external tools. Each record is
+// a length byte followed by that many payload bytes, which start with the token type:
+//
+//	DumpLiteral: [2] [0] [byte]
+//	DumpMatch:   [9] [1] [offset, big-endian uint32] [length, big-endian uint32]
+//
+// Parsers should skip records with an unknown type using the length byte. Tokens are checked
+// as Decode checks them, honouring MaxTokens and Trailing.
+func (l *Lzss) DumpTokens(input []byte, w io.Writer) error {
+	if len(input) == 0 {
+		return nil
+	}
+
+	stream := l.newBitStream(input)
+	originalLength, err := l.readHeader(&stream)
+	if err != nil {
+		return err
+	}
+
+	err = l.checkOriginalLength(originalLength, uint32(len(input)))
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(w)
+	record := make([]byte, 0, 10)
+
+	for index, tokens := uint32(0), uint32(0); index < originalLength; tokens += 1 {
+		token, err := l.readCheckedToken(&stream, index, originalLength, tokens)
+		if err != nil {
+			return err
+		}
+
+		if token.isPair {
+			record = append(record[:0], 9, DumpMatch)
+			record = binary.BigEndian.AppendUint32(record, token.offset)
+			record = binary.BigEndian.AppendUint32(record, token.length)
+		} else {
+			record = append(record[:0], 2, DumpLiteral, token.literal)
+		}
+
+		_, err = writer.Write(record)
+		if err != nil {
+			return err
+		}
+
+		index += token.length
+	}
+
+	err = l.checkTrailing(&stream)
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,390 @@
+// Package lzss is the Go port of the LZSS rosetta: an LZSS codec with configurable offset and
+// length widths, producing byte-identical streams to the other ports for the same settings.
+//
+//	l := lzss.NewLzss(10, 6, 2)
+//	compressed, err := l.Encode(data)
+//	...
+//	data, err = l.Decode(compressed)
+//
+// A stream is the original length as a 7-bit varint followed by the tokens, MSB first: a 0
+// bit and 8 literal bits, or a 1 bit, offsetBits of offset and lengthBits of length.
+package lzss
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Silly silly Go
+func ternary[T any](condition bool, a T, b T) T {
+	if condition {
+		return a
+	}
+
+	return b
+}
+
+// MetricsSink receives observations from Encode, so they can be forwarded to a
+// metrics library (e.g. a Prometheus histogram) without this code depending on it.
+type MetricsSink interface {
+	Observe(name string, value float64)
+}
+
+const (
+	MetricMatchLength = "match_length"
+	MetricMatchOffset = "match_offset"
+	MetricRatio       = "ratio" //Compressed size divided by input size, once per Encode
+)
+
+// Lzss holds the parameters of a stream and the options of the encoder and decoder. Both
+// sides must use the same NewLzss arguments and the same format options.
+type Lzss struct {
+	offsetBits byte
+	lengthBits byte
+
+	maxOffset uint32
+
+	minimumLength uint32
+	maximumLength uint32
+
+	//Optional, observed on every match and once per Encode
+	Metrics MetricsSink
+
+	//Bytes Encode may allocate for its output, 0 for no limit. With a limit Encode also does
+	//without its match tables and scans the whole window at every position, which is much
+	//slower but produces the same output
+	MaxEncodeMemory uint32
+
+	//Optional, called by Encode with the input bytes done and output bytes written so far,
+	//roughly every progressInterval input bytes and once more when done == total
+	OnProgress func(done, total, written uint32)
+
+	//Most tokens Decode reads before giving up, 0 for no limit
+	MaxTokens uint32
+
+	//Make Encode return ErrIncompressible instead of output that isn't smaller than the
+	//input, so the caller can store the raw bytes instead
+	FailIncompressible bool
+
+	//Prefer matches whose offset is a multiple of AlignHint (e.g. the instruction width), even
+	//when they are a byte shorter than the longest match. 0 or 1 disables it
+	AlignHint uint32
+
+	//Store the original length as a big-endian uint32 (little-endian with LSBFirst) in bytes
+	//0-3 instead of a 7-bit varint, so external tools can read it at a fixed offset
+	FixedLengthHeader bool
+
+	//Never emit a match longer than its offset, so decoders can use a plain non-overlapping copy
+	NoOverlap bool
+
+	//Constrains the matches Encode emits so decoding fits a latency budget, see DecodeLatencyClass
+	LatencyClass DecodeLatencyClass
+
+	//What Decode accepts after the last token
+	Trailing TrailingPolicy
+
+	//Store match lengths minus minimumLength, so matches can be up to minimumLength bytes longer
+	//for the same lengthBits. A different stream format, both sides must agree
+	BiasedLength bool
+
+	//Start streams with a header naming the format and its parameters, see DecodeAuto. Off by
+	//default, since the other ports don't expect it
+	SelfDescribing bool
+
+	//Optional, replaces the built-in match search, see MatchFinder
+	Finder MatchFinder
+
+	//Emit a literal instead of a match when the match at the next byte is longer. Better ratio
+	//for somewhat slower encoding, the stream format is the same
+	Lazy bool
+
+	//Choose the cheapest sequence of tokens for the whole input instead of one match at a
+	//time, see parseOptimal. The best ratio and the slowest encoding, overrides Lazy
+	Optimal bool
+
+	//Pack bits into each byte from the least significant one up, and write every field least
+	//significant bit first, as deflate does. Whole bytes on byte boundaries read the same
+	//either way, but 32-bit fields (FixedLengthHeader, checksums) come out little-endian.
+	//A different stream format, both sides must agree
+	LSBFirst bool
+
+	//Input bytes past the end of every block the Writer looks at before it encodes the block,
+	//at least the longest match, so matches starting in one block can run as far into the next
+	//one as if there were no block boundary. Longer lookaheads give the Lazy and Optimal parses
+	//more to decide on, for more memory and as much more parsing per block
+	LookaheadBytes uint32
+
+	//End Writer streams with the IEEE CRC-32 of everything written, for the Reader to verify
+	//at the end of the stream. A different stream format, both sides must agree
+	StreamChecksum bool
+
+	//Input bytes per block of EncodeParallel, 0 for 1 MiB
+	ParallelBlockSize uint32
+
+	//Encode every EncodeParallel block with EncodeWithChecksum, so DecodeParallel can tell
+	//which block is corrupt. A different format, both sides must agree
+	ParallelChecksum bool
+
+	//Set by EncodeContext
+	ctx context.Context
+
+	//Set by EncodeTrace, called with every token Encode writes and its position in the input
+	onToken func(token token, index uint32)
+}
+
+// TrailingPolicy decides what Decode does with the input left after the last token, which
+// catches truncated or concatenated streams.
+type TrailingPolicy byte
+
+const (
+	TrailingIgnore      TrailingPolicy = iota //Ignore the padding bits and any bytes after them
+	TrailingZeroPadding                       //Fail with ErrTrailingBits unless the 0-7 padding bits are 0
+	TrailingExactEnd                          //TrailingZeroPadding, and fail with ErrTrailingBytes if whole bytes remain
+)
+
+const progressInterval = 64 * 1024
+
+// Input bytes between checks of the EncodeContext context, a few microseconds of encoding
+const cancelInterval = 4 * 1024
+
+// DecodeLatencyClass bounds the work Decode does per output byte and per token. Decode work
+// is the bits it reads plus the bytes it copies; every output byte is copied exactly once.
+type DecodeLatencyClass byte
+
+const (
+	//Only matches cheaper than their literals, which Encode always emits, so Decode reads at
+	//most 9 bits per output byte: 9 Mbit and at most 1M tokens per MB of output. Overlapping
+	//matches have to be copied byte by byte
+	LatencyBounded DecodeLatencyClass = iota
+
+	//LatencyBounded, plus every match is a non-overlapping copy (as with NoOverlap) of at most
+	//latencyRealtimeLength bytes, so no single token takes more than one short memmove. Suits
+	//decoders that slice their work into fixed frame budgets
+	LatencyRealtime
+)
+
+const latencyRealtimeLength = 32
+
+func (l *Lzss) noOverlap() bool {
+	return l.NoOverlap || l.LatencyClass >= LatencyRealtime
+}
+
+// What BiasedLength subtracts from the stored match lengths
+func (l *Lzss) getLengthBias() uint32 {
+	return ternary(l.BiasedLength, l.minimumLength, 0)
+}
+
+// The longest match a stream can hold
+func (l *Lzss) getMaximumLength() uint32 {
+	return l.maximumLength + l.getLengthBias()
+}
+
+// The longest match Encode emits
+func (l *Lzss) getMaximumMatchLength() uint32 {
+	if l.LatencyClass >= LatencyRealtime && l.getMaximumLength() > latencyRealtimeLength {
+		return latencyRealtimeLength
+	}
+
+	return l.getMaximumLength()
+}
+
+// NewLzss returns a codec for offsetBits wide offsets and lengthBits wide lengths, emitting
+// matches of at least minimumLength bytes. The rosetta vectors use NewLzss(10, 6, 2).
+func NewLzss(offsetBits, lengthBits byte, minimumLength uint32) Lzss {
+	return Lzss{
+		offsetBits: offsetBits,
+		lengthBits: lengthBits,
+
+		maxOffset: (1 << offsetBits) - 1,
+
+		minimumLength: minimumLength,
+		maximumLength: (1 << lengthBits) - 1,
+	}
+}
+
+var ErrInvalidConfig = errors.New("Invalid configuration")
+
+// NewLzssChecked is NewLzss for parameters that come from outside: it fails with an error
+// wrapping ErrInvalidConfig unless offsetBits and lengthBits are in 1..31 and minimumLength is
+// in 1..maximumLength. NewLzss wraps the shifts around for 32 or more bits, and never emits a
+// match with a minimumLength above maximumLength.
+func NewLzssChecked(offsetBits, lengthBits byte, minimumLength uint32) (Lzss, error) {
+	if offsetBits < 1 || offsetBits > 31 {
+		return Lzss{}, fmt.Errorf("%w: offsetBits %d is not in 1..31", ErrInvalidConfig, offsetBits)
+	}
+
+	if lengthBits < 1 || lengthBits > 31 {
+		return Lzss{}, fmt.Errorf("%w: lengthBits %d is not in 1..31", ErrInvalidConfig, lengthBits)
+	}
+
+	l := NewLzss(offsetBits, lengthBits, minimumLength)
+	if minimumLength < 1 || minimumLength > l.maximumLength {
+		return Lzss{}, fmt.Errorf("%w: minimumLength %d is not in 1..%d", ErrInvalidConfig, minimumLength, l.maximumLength)
+	}
+
+	return l, nil
+}
+
+// Presets are tuned by sweeping offsetBits 8-16, lengthBits 3-7 and minimumLength 2-4 over
+// the corpus files of their kind, keeping the smallest total output. Only kinds where one
+// setting clearly beats NewLzss(10, 6, 2) on every sample have one: the binary samples want
+// opposite settings (8,5,2 is 8% smaller on kennedy.xls and 15% bigger on ptt5), and there
+// are no log samples.
+
+// PresetText is for natural language text, tuned on alice29, asyoulik, lcet10 and plrabn12:
+// a 64K window finds phrases repeated pages apart, which rarely run past 15 bytes, so short
+// length fields win. 37% smaller than NewLzss(10, 6, 2).
+func PresetText() Lzss {
+	return NewLzss(16, 4, 4)
+}
+
+// PresetExecutable is for machine code, tuned on the one sample, sum: a 16K window with
+// matches of up to 31 bytes. 16% smaller than NewLzss(10, 6, 2). Preferring aligned offsets
+// (AlignHint) made it worse.
+func PresetExecutable() Lzss {
+	return NewLzss(14, 5, 3)
+}
+
+// GetUpperBound returns the largest possible Encode output for inputLength bytes. It is a
+// uint64 since the bound for a large input doesn't fit in 32 bits.
+func (l *Lzss) GetUpperBound(inputLength uint32) uint64 {
+	headerBits := 8 * uint64(l.getHeaderLength(inputLength))
+	return (headerBits + l.getTokensUpperBound(uint64(inputLength)) + 7) / 8
+}
+
+// Bits of the tokens of inputLength bytes in the worst case, every byte a literal, since every
+// match is cheaper than its literals
+func (l *Lzss) getTokensUpperBound(inputLength uint64) uint64 {
+	return 9 * inputLength
+}
+
+// Bytes to allocate for encoding inputLength bytes plus extra, no more than a bitStream addresses
+func (l *Lzss) getEncodeBufferLength(inputLength uint32, extra uint64) uint64 {
+	return min(l.GetUpperBound(inputLength)+extra, math.MaxUint32)
+}
+
+// The header of a SelfDescribing stream, before the length:
+//
+//	["LZ"] [version] [offsetBits] [lengthBits] [minimumLength, big-endian uint32] [flags]
+const (
+	descriptionMagic   = "LZ"
+	descriptionVersion = 1
+	descriptionLength  = 10
+
+	descriptionFixedLengthHeader = 1
+	descriptionBiasedLength      = 2
+	descriptionLSBFirst          = 4
+)
+
+func (l *Lzss) getDescriptionLength() uint32 {
+	return ternary[uint32](l.SelfDescribing, descriptionLength, 0)
+}
+
+func (l *Lzss) getDescriptionFlags() byte {
+	return ternary[byte](l.FixedLengthHeader, descriptionFixedLengthHeader, 0) | ternary[byte](l.BiasedLength, descriptionBiasedLength, 0) |
+		ternary[byte](l.LSBFirst, descriptionLSBFirst, 0)
+}
+
+func (l *Lzss) writeHeader(stream *bitStream, originalLength uint32) error {
+	if l.SelfDescribing {
+		description := append([]byte(descriptionMagic), descriptionVersion, l.offsetBits, l.lengthBits)
+		description = binary.BigEndian.AppendUint32(description, l.minimumLength)
+		description = append(description, l.getDescriptionFlags())
+
+		for _, b := range description {
+			err := stream.writeUint32(uint32(b), 8)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if l.FixedLengthHeader {
+		return stream.writeUint32(originalLength, 32)
+	}
+
+	return stream.write7BitUint32(originalLength)
+}
+
+func (l *Lzss) readHeader(stream *bitStream) (uint32, error) {
+	if l.SelfDescribing {
+		start := stream.bufferPosition
+		if stream.bufferLength-start < descriptionLength {
+			return 0, ErrUnexpectedEOF
+		}
+		stream.bufferPosition += descriptionLength
+
+		described, err := readDescription(stream.buffer[start:stream.bufferPosition])
+		if err != nil {
+			return 0, err
+		}
+
+		if described.offsetBits != l.offsetBits || described.lengthBits != l.lengthBits || described.minimumLength != l.minimumLength || described.getDescriptionFlags() != l.getDescriptionFlags() {
+			return 0, ErrConfigMismatch
+		}
+	}
+
+	if l.FixedLengthHeader {
+		return stream.readUint32(32)
+	}
+
+	return stream.read7BitUint32()
+}
+
+var ErrNotSelfDescribing = errors.New("Stream does not start with a format header")
+
+// Returns the configuration a format header describes
+func readDescription(description []byte) (Lzss, error) {
+	if len(description) < descriptionLength || string(description[:2]) != descriptionMagic {
+		return Lzss{}, ErrNotSelfDescribing
+	}
+
+	if description[2] != descriptionVersion {
+		return Lzss{}, fmt.Errorf("Unknown format version %d", description[2])
+	}
+
+	flags := description[9]
+	if flags&^(descriptionFixedLengthHeader|descriptionBiasedLength|descriptionLSBFirst) != 0 {
+		return Lzss{}, fmt.Errorf("Unknown format flags %#x", flags)
+	}
+
+	l, err := NewLzssChecked(description[3], description[4], binary.BigEndian.Uint32(description[5:9]))
+	if err != nil {
+		return Lzss{}, err
+	}
+
+	l.SelfDescribing = true
+	l.FixedLengthHeader = flags&descriptionFixedLengthHeader != 0
+	l.BiasedLength = flags&descriptionBiasedLength != 0
+	l.LSBFirst = flags&descriptionLSBFirst != 0
+
+	return l, nil
+}
+
+// DecodeAuto decodes a stream encoded with SelfDescribing set, using the parameters from its
+// header instead of an Lzss from the caller.
+func DecodeAuto(input []byte) ([]byte, error) {
+	if len(input) == 0 {
+		return []byte{}, nil
+	}
+
+	l, err := readDescription(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.Decode(input)
+}
+
+func (l *Lzss) getHeaderLength(originalLength uint32) uint32 {
+	return l.getDescriptionLength() + ternary(l.FixedLengthHeader, 4, get7BitLength(originalLength))
+}
+
+// GetOriginalLength reads the decoded length from the header of a stream.
+func (l *Lzss) GetOriginalLength(input []byte) (uint32, error) {
+	stream := l.newBitStream(input)
+	return l.readHeader(&stream)
+}
@@ -0,0 +1,2874 @@
+package lzss
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Reads a file of the corpus at the root of the repo
+func readCorpus(t testing.TB, name string) []byte {
+	t.Helper()
+
+	input, err := os.ReadFile("../corpus/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return input
+}
+
+type fakeSink struct {
+	observations map[string][]float64
+}
+
+func (s *fakeSink) Observe(name string, value float64) {
+	s.observations[name] = append(s.observations[name], value)
+}
+
+func TestMetricsSink(t *testing.T) {
+	input := readCorpus(t, "grammar.lsp")
+
+	sink := &fakeSink{observations: map[string][]float64{}}
+	l := NewLzss(10, 6, 2)
+	l.Metrics = sink
+
+	compressed, stats, err := l.EncodeStats(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lengths, offsets := sink.observations[MetricMatchLength], sink.observations[MetricMatchOffset]
+	if len(lengths) != int(stats.Matches) || len(offsets) != int(stats.Matches) {
+		t.Fatalf("observed %d lengths and %d offsets for %d matches", len(lengths), len(offsets), stats.Matches)
+	}
+
+	total := 0.0
+	for i, length := range lengths {
+		total += length
+		if offsets[i] < 1 || offsets[i] > float64(l.maxOffset) {
+			t.Errorf("observed offset %v outside the window", offsets[i])
+		}
+	}
+	if total != float64(stats.MatchedBytes) {
+		t.Errorf("observed lengths sum to %v, matches cover %d bytes", total, stats.MatchedBytes)
+	}
+
+	ratios := sink.observations[MetricRatio]
+	if len(ratios) != 1 || ratios[0] != float64(len(compressed))/float64(len(input)) {
+		t.Errorf("observed ratios %v, want one of %v", ratios, float64(len(compressed))/float64(len(input)))
+	}
+}
+
+// Random bytes that don't compress, from a fixed seed
+func getRandomInput(length int, seed int64) []byte {
+	input := make([]byte, length)
+	rand.New(rand.NewSource(seed)).Read(input)
+	return input
+}
+
+func TestDecodeInPlace(t *testing.T) {
+	inputs := map[string][]byte{
+		"text":   readCorpus(t, "alice29.txt")[:20000],
+		"random": getRandomInput(5000, 1),
+		"runs":   bytes.Repeat([]byte("aaaaaaaaab"), 500),
+	}
+
+	for _, l := range []Lzss{NewLzss(10, 6, 2), NewLzss(14, 4, 3), NewLzss(8, 8, 1)} {
+		for name, input := range inputs {
+			compressed, err := l.Encode(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected, err := l.Decode(compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			size, err := l.GetInPlaceSize(compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buf := make([]byte, size)
+			copy(buf[len(buf)-len(compressed):], compressed)
+
+			output, err := l.DecodeInPlace(buf, len(compressed))
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+
+			if !bytes.Equal(output, expected) {
+				t.Errorf("%s: in-place output differs from Decode", name)
+			}
+		}
+	}
+
+	l := NewLzss(10, 6, 2)
+	input := append(make([]byte, 1000), getRandomInput(1000, 13)...)
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffers := map[string]struct {
+		buf           []byte
+		compressedLen int
+	}{
+		"longer input": {make([]byte, 10), 11},
+		"short output": {bytes.Clone(compressed), len(compressed)},
+
+		//In a buffer only as big as the output, the zeros decode past the stream read so far
+		//into the random literals still to be read
+		"overwrite": {append(make([]byte, len(input)-len(compressed)), compressed...), len(compressed)},
+	}
+
+	for name, c := range buffers {
+		_, err := l.DecodeInPlace(c.buf, c.compressedLen)
+		if !errors.Is(err, ErrShortBuffer) {
+			t.Errorf("%s: DecodeInPlace returned %v, want ErrShortBuffer", name, err)
+		}
+	}
+}
+
+// Parses a DumpTokens stream the way an external tool would, knowing only the format
+func parseDump(t *testing.T, dump []byte) []Token {
+	t.Helper()
+
+	var tokens []Token
+	for len(dump) > 0 {
+		length := int(dump[0])
+		if length == 0 || 1+length > len(dump) {
+			t.Fatalf("truncated record of %d bytes", length)
+		}
+		record := dump[1 : 1+length]
+		dump = dump[1+length:]
+
+		switch {
+		case record[0] == DumpLiteral && length == 2:
+			tokens = append(tokens, Token{Literal: record[1], Length: 1})
+		case record[0] == DumpMatch && length == 9:
+			tokens = append(tokens, Token{IsPair: true, Offset: binary.BigEndian.Uint32(record[1:]), Length: binary.BigEndian.Uint32(record[5:])})
+		default:
+			t.Fatalf("unknown record type %d of %d bytes", record[0], length)
+		}
+	}
+
+	return tokens
+}
+
+func TestDumpTokens(t *testing.T) {
+	input := readCorpus(t, "xargs.1")
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dump bytes.Buffer
+	err = l.DumpTokens(compressed, &dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output []byte
+	for _, token := range parseDump(t, dump.Bytes()) {
+		if !token.IsPair {
+			output = append(output, token.Literal)
+			continue
+		}
+
+		for i := uint32(0); i < token.Length; i += 1 {
+			output = append(output, output[len(output)-int(token.Offset)])
+		}
+	}
+
+	if !bytes.Equal(output, input) {
+		t.Errorf("the parsed dump rebuilds %d bytes that differ from the %d byte input", len(output), len(input))
+	}
+
+	limited := l
+	limited.MaxTokens = 100
+	err = limited.DumpTokens(compressed, io.Discard)
+	if !errors.Is(err, ErrTooManyTokens) {
+		t.Errorf("MaxTokens of 100 returned %v, want ErrTooManyTokens", err)
+	}
+
+	exact := l
+	exact.Trailing = TrailingExactEnd
+	err = exact.DumpTokens(append(bytes.Clone(compressed), 0), io.Discard)
+	if !errors.Is(err, ErrTrailingBytes) {
+		t.Errorf("a trailing byte returned %v, want ErrTrailingBytes", err)
+	}
+
+	//The same offsets past a window of 100 that Decode rejects
+	wide := NewLzss(16, 4, 2)
+	compressed, err = wide.Encode(bytes.Repeat(getRandomInput(200, 12), 50))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	window, err := New(WithOffsetBits(16), WithLengthBits(4), WithMinimumLength(2), WithMaxOffset(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = window.DumpTokens(compressed, io.Discard)
+	if !errors.Is(err, ErrInvalidBackReference) {
+		t.Errorf("matches past the window returned %v, want ErrInvalidBackReference", err)
+	}
+}
+
+// Configurations that change the parse or the header, for tests that must hold for all of them
+func getTestConfigs() map[string]Lzss {
+	configs := map[string]Lzss{
+		"10,6,2": NewLzss(10, 6, 2),
+		"14,4,3": NewLzss(14, 4, 3),
+		"8,8,1":  NewLzss(8, 8, 1),
+	}
+
+	lazy := NewLzss(12, 4, 2)
+	lazy.Lazy = true
+	configs["lazy"] = lazy
+
+	optimal := NewLzss(12, 4, 2)
+	optimal.Optimal = true
+	configs["optimal"] = optimal
+
+	headers := NewLzss(10, 6, 2)
+	headers.SelfDescribing = true
+	headers.FixedLengthHeader = true
+	configs["headers"] = headers
+
+	return configs
+}
+
+// DryRunSize of an input that must not fail
+func getDryRunSize(t *testing.T, l Lzss, input []byte) uint32 {
+	t.Helper()
+
+	size, err := l.DryRunSize(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return size
+}
+
+func TestDryRunSize(t *testing.T) {
+	inputs := [][]byte{{1}, readCorpus(t, "fields.c"), getRandomInput(3000, 2), bytes.Repeat([]byte{0}, 100000)}
+
+	for name, l := range getTestConfigs() {
+		for _, input := range inputs {
+			compressed, err := l.Encode(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			size, err := l.DryRunSize(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != uint32(len(compressed)) {
+				t.Errorf("%s: DryRunSize of %d bytes is %d, Encode wrote %d", name, len(input), size, len(compressed))
+			}
+		}
+	}
+
+	//A parse that fails returns its error, not the size of the tokens before it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l := NewLzss(10, 6, 2)
+	l.Optimal = true
+	l.ctx = ctx
+
+	size, err := l.DryRunSize(inputs[1])
+	if !errors.Is(err, context.Canceled) || size != 0 {
+		t.Errorf("a cancelled parse returned %d, %v, want context.Canceled", size, err)
+	}
+}
+
+func TestDecodeExpect(t *testing.T) {
+	input := readCorpus(t, "grammar.lsp")
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksum := crc32.ChecksumIEEE(input)
+
+	output, err := l.DecodeExpect(compressed, uint32(len(input)), checksum)
+	if err != nil || !bytes.Equal(output, input) {
+		t.Fatalf("DecodeExpect of the stored bytes failed: %v", err)
+	}
+
+	_, err = l.DecodeExpect(compressed, uint32(len(input))+1, checksum)
+	if !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("a wrong length returned %v, want ErrLengthMismatch", err)
+	}
+
+	_, err = l.DecodeExpect(compressed, uint32(len(input)), checksum+1)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("a wrong checksum returned %v, want ErrChecksumMismatch", err)
+	}
+
+	//Stored bytes that changed: a literal of the first token, after the length header
+	corrupt := bytes.Clone(compressed)
+	corrupt[2] ^= 0x02
+	_, err = l.DecodeExpect(corrupt, uint32(len(input)), checksum)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("corrupt stored bytes returned %v, want ErrChecksumMismatch", err)
+	}
+
+	_, err = l.DecodeExpect(nil, 1, checksum)
+	if !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("an empty stream returned %v, want ErrLengthMismatch", err)
+	}
+}
+
+func TestCodecAllocations(t *testing.T) {
+	input := readCorpus(t, "alice29.txt")[:16*1024]
+	codec := NewCodec(NewLzss(10, 6, 2))
+
+	compressed := make([]byte, codec.Lzss.GetUpperBound(uint32(len(input))))
+	decompressed := make([]byte, len(input))
+
+	var output []byte
+	allocations := testing.AllocsPerRun(20, func() {
+		var err error
+		output, err = codec.Compress(compressed, input)
+		if err == nil {
+			output, err = codec.Decompress(decompressed, output)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if allocations != 0 {
+		t.Errorf("a compress and decompress cycle allocates %v times", allocations)
+	}
+
+	if !bytes.Equal(output, input) {
+		t.Error("the cycle does not round-trip")
+	}
+}
+
+func TestEncodeWithBoundaries(t *testing.T) {
+	//Identical records, so every record but the first would match the one before it
+	record := []byte("user=alice;balance=1000;email=alice@example.com\n")
+	input := bytes.Repeat(record, 20)
+
+	var boundaries []uint32
+	for i := 1; i < 20; i += 1 {
+		boundaries = append(boundaries, uint32(i*len(record)))
+	}
+
+	l := NewLzss(10, 6, 2)
+	compressed, err := l.EncodeWithBoundaries(input, boundaries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, tokens, err := l.DecodeWithTokens(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, input) {
+		t.Fatal("the output does not decode to the input")
+	}
+
+	segment := func(index uint32) uint32 { return index / uint32(len(record)) }
+	for _, token := range tokens {
+		if !token.IsPair {
+			continue
+		}
+
+		first, last := token.Index-token.Offset, token.Index+token.Length-1
+		if segment(first) != segment(token.Index) || segment(last) != segment(token.Index) {
+			t.Errorf("match at %d copies %d bytes from %d across a boundary", token.Index, token.Length, first)
+		}
+	}
+}
+
+// Decodes with DecodeCallback, returning the concatenated chunks and how many there were
+func decodeChunks(l Lzss, compressed []byte) ([]byte, int, error) {
+	var output []byte
+	chunks := 0
+	err := l.DecodeCallback(compressed, func(chunk []byte) error {
+		output = append(output, chunk...)
+		chunks += 1
+		return nil
+	})
+
+	return output, chunks, err
+}
+
+func TestDecodeCallback(t *testing.T) {
+	input := readCorpus(t, "alice29.txt")
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, chunks, err := decodeChunks(l, compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, input) || chunks < len(input)/decodeChunkSize {
+		t.Errorf("decoded %d bytes in %d chunks, want the %d byte input in chunks", len(output), chunks, len(input))
+	}
+
+	//An error from emit stops decoding and is returned as is
+	errEmit := errors.New("emit failed")
+	calls := 0
+	err = l.DecodeCallback(compressed, func(chunk []byte) error {
+		calls += 1
+		return errEmit
+	})
+	if err != errEmit || calls != 1 {
+		t.Errorf("emit failing returned %v after %d calls, want its error after 1", err, calls)
+	}
+
+	limited := l
+	limited.MaxTokens = 10
+	_, _, err = decodeChunks(limited, compressed)
+	if !errors.Is(err, ErrTooManyTokens) {
+		t.Errorf("MaxTokens returned %v, want ErrTooManyTokens", err)
+	}
+
+	exact := l
+	exact.Trailing = TrailingExactEnd
+	_, _, err = decodeChunks(exact, append(bytes.Clone(compressed), 0))
+	if !errors.Is(err, ErrTrailingBytes) {
+		t.Errorf("a trailing byte returned %v, want ErrTrailingBytes", err)
+	}
+}
+
+func TestDecodeCallbackWindow(t *testing.T) {
+	//A window and longest match of 2 GiB each, which overflowed uint32
+	l, err := NewLzssChecked(31, 31, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := readCorpus(t, "alice29.txt")[:100000]
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	allocated := stats.TotalAlloc
+
+	output, _, err := decodeChunks(l, compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, input) {
+		t.Error("the output differs from the input")
+	}
+
+	//Only as big as the output, not the window, and the output again for decodeChunks
+	runtime.ReadMemStats(&stats)
+	if stats.TotalAlloc-allocated > 3*uint64(len(input)) {
+		t.Errorf("decoding %d bytes allocated %d", len(input), stats.TotalAlloc-allocated)
+	}
+
+	//Matches 200 bytes back, which the offset field holds but a window of 100 doesn't
+	hostile, err := New(WithOffsetBits(16), WithLengthBits(4), WithMinimumLength(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err = hostile.Encode(bytes.Repeat(getRandomInput(200, 12), 500))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	window, err := New(WithOffsetBits(16), WithLengthBits(4), WithMinimumLength(2), WithMaxOffset(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = decodeChunks(window, compressed)
+	if !errors.Is(err, ErrInvalidBackReference) {
+		t.Errorf("DecodeCallback of matches past the window returned %v, want ErrInvalidBackReference", err)
+	}
+	_, err = window.Decode(compressed)
+	if !errors.Is(err, ErrInvalidBackReference) {
+		t.Errorf("Decode of matches past the window returned %v, want ErrInvalidBackReference", err)
+	}
+}
+
+func TestPresets(t *testing.T) {
+	presets := map[string]struct {
+		l     Lzss
+		files []string
+	}{
+		"text":       {PresetText(), []string{"alice29.txt", "asyoulik.txt", "lcet10.txt", "plrabn12.txt"}},
+		"executable": {PresetExecutable(), []string{"sum"}},
+	}
+
+	naive := NewLzss(10, 6, 2)
+	for name, preset := range presets {
+		l := preset.l
+
+		size, naiveSize := uint32(0), uint32(0)
+		for _, file := range preset.files {
+			input := readCorpus(t, file)
+			size += getDryRunSize(t, l, input)
+			naiveSize += getDryRunSize(t, naive, input)
+		}
+
+		if size >= naiveSize {
+			t.Errorf("%s: the preset compresses its files to %d bytes, NewLzss(10, 6, 2) to %d", name, size, naiveSize)
+		}
+	}
+}
+
+func TestEncodeSparse(t *testing.T) {
+	//Records scattered over zeroed pages, like a sparse file
+	input := make([]byte, 1<<20)
+	record := readCorpus(t, "fields.c")[:300]
+	for i := 0; i+len(record) <= len(input); i += 40000 {
+		copy(input[i:], record)
+		record[0] += 1
+	}
+
+	l := NewLzss(10, 6, 2)
+	sparse, err := l.EncodeSparse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := l.DecodeSparse(sparse)
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Plain Encode pays a token per maximumLength zeros
+	dense := getDryRunSize(t, l, input)
+	if uint32(len(sparse)) > dense/10 {
+		t.Errorf("EncodeSparse wrote %d bytes, Encode %d", len(sparse), dense)
+	}
+
+	//One run of 2^64-1 zeros after 1 byte, which wrapped the total length to 0
+	stream, err := l.Encode([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crafted := append([]byte{1, 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1}, stream...)
+	_, err = l.DecodeSparse(crafted)
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("a run longer than 4 GiB returned %v, want ErrCorrupt", err)
+	}
+}
+
+func TestDecodeSeq(t *testing.T) {
+	input := readCorpus(t, "lcet10.txt")
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output []byte
+	for b, err := range l.DecodeSeq(compressed) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		output = append(output, b)
+	}
+	if !bytes.Equal(output, input) {
+		t.Errorf("yielded %d bytes that differ from the %d byte input", len(output), len(input))
+	}
+
+	//Yielding after the break would panic
+	count := 0
+	for range l.DecodeSeq(compressed) {
+		count += 1
+		if count == 10 {
+			break
+		}
+	}
+
+	for _, err := range l.DecodeSeq(compressed[:len(compressed)/2]) {
+		if err != nil {
+			return
+		}
+	}
+	t.Error("a truncated stream yielded no error")
+}
+
+// The window scan comparing every candidate from its first byte, without carrying lengths
+type plainScanFinder struct {
+	l *Lzss
+}
+
+func newPlainScanFinder(l *Lzss) MatchFinder {
+	return plainScanFinder{l: l}
+}
+
+func (f plainScanFinder) FindMatch(input []byte, index uint32) Match {
+	l := f.l
+	offset := ternary(l.maxOffset > index, 0, index-l.maxOffset)
+	bestOffset, bestLength := findLongestMatch(input, offset, index, l.noOverlap())
+
+	return Match{Offset: index - bestOffset, Length: min(bestLength, l.getMaximumMatchLength())}
+}
+
+func TestHashChain(t *testing.T) {
+	inputs := map[string][]byte{
+		"text":   readCorpus(t, "alice29.txt")[:6000],
+		"source": readCorpus(t, "grammar.lsp"),
+		"random": getRandomInput(3000, 5),
+		"runs":   bytes.Repeat([]byte("aaaaaaaaab"), 300),
+	}
+
+	for name, l := range getTestConfigs() {
+		for inputName, input := range inputs {
+			expected, err := l.Encode(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			//The scan with the lengths it carries forward, and without
+			for scanName, newFinder := range map[string]func(l *Lzss) MatchFinder{"scan": (*Lzss).NewScanFinder, "plain scan": newPlainScanFinder} {
+				scan := l
+				scan.Finder = newFinder(&scan)
+				compressed, err := scan.Encode(input)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(compressed, expected) {
+					t.Errorf("%s/%s: the hash chain wrote %d bytes that differ from the %d of the %s", name, inputName, len(expected), len(compressed), scanName)
+				}
+			}
+		}
+	}
+}
+
+func TestLazy(t *testing.T) {
+	for _, file := range []string{"alice29.txt", "lcet10.txt", "cp.html"} {
+		input := readCorpus(t, file)
+		greedy := NewLzss(12, 4, 2)
+		lazy := greedy
+		lazy.Lazy = true
+
+		compressed, err := lazy.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := lazy.Decode(compressed)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+
+		greedySize := getDryRunSize(t, greedy, input)
+		if uint32(len(compressed)) >= greedySize {
+			t.Errorf("%s: lazy matching wrote %d bytes, greedy %d", file, len(compressed), greedySize)
+		}
+
+		for _, token := range lazy.Tokens(input) {
+			if token.IsPair && (token.Length < lazy.minimumLength || token.Length > lazy.getMaximumLength()) {
+				t.Fatalf("%s: match of %d bytes at %d, outside %d-%d", file, token.Length, token.Index, lazy.minimumLength, lazy.getMaximumLength())
+			}
+		}
+	}
+}
+
+func TestEncodeSplit(t *testing.T) {
+	inputs := [][]byte{[]byte("a"), readCorpus(t, "cp.html"), getRandomInput(2000, 6), bytes.Repeat([]byte{7}, 5000)}
+
+	for name, l := range getTestConfigs() {
+		for _, input := range inputs {
+			tokens, literals, err := l.EncodeSplit(input)
+			if err != nil {
+				t.Fatalf("%s: EncodeSplit of %d bytes: %s", name, len(input), err)
+			}
+
+			output, err := l.DecodeSplit(tokens, literals)
+			if err == nil {
+				err = checkRoundTrip(input, output)
+			}
+			if err != nil {
+				t.Errorf("%s: %d bytes: %s", name, len(input), err)
+			}
+		}
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	input := readCorpus(t, "xargs.1")
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Big enough, with room to spare: resliced to the output
+	dst := make([]byte, 10, 2*len(input))
+	output, err := l.DecodeInto(compressed, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, input) || &output[0] != &dst[0] {
+		t.Errorf("decoded %d bytes outside of a %d byte dst", len(output), cap(dst))
+	}
+
+	//One byte short: a new buffer, dst untouched
+	dst = make([]byte, len(input)-1)
+	output, err = l.DecodeInto(compressed, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, input) || &output[0] == &dst[0] || bytes.Count(dst, []byte{0}) != len(dst) {
+		t.Error("a dst one byte short was written to")
+	}
+
+	output, err = l.DecodeInto(nil, dst)
+	if err != nil || len(output) != 0 {
+		t.Errorf("an empty stream decoded to %d bytes, %v", len(output), err)
+	}
+}
+
+// Every decoder must apply MaxTokens and Trailing the same way
+func TestDecodeLimits(t *testing.T) {
+	input := readCorpus(t, "grammar.lsp")
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, literals, err := l.EncodeSplit(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stream bytes.Buffer
+	z := l.NewWriter(&stream)
+	z.Write(input)
+	err = z.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoders := map[string]func(l Lzss, trailing []byte) error{
+		"Decode": func(l Lzss, trailing []byte) error {
+			_, err := l.Decode(append(bytes.Clone(compressed), trailing...))
+			return err
+		},
+		"DecodeInPlace": func(l Lzss, trailing []byte) error {
+			stored := append(bytes.Clone(compressed), trailing...)
+			size, err := l.GetInPlaceSize(stored)
+			if err != nil {
+				return err
+			}
+
+			buf := make([]byte, size)
+			copy(buf[len(buf)-len(stored):], stored)
+			_, err = l.DecodeInPlace(buf, len(stored))
+			return err
+		},
+		"DecodeSplit": func(l Lzss, trailing []byte) error {
+			_, err := l.DecodeSplit(append(bytes.Clone(tokens), trailing...), literals)
+			return err
+		},
+		"Reader": func(l Lzss, trailing []byte) error {
+			//The trailing bytes go at the end of the block, which is one byte longer
+			block := bytes.Clone(stream.Bytes())
+			if len(trailing) > 0 {
+				_, n := binary.Uvarint(block)
+				tokensLength, m := binary.Uvarint(block[n:])
+				header := binary.AppendUvarint(bytes.Clone(block[:n]), tokensLength+uint64(len(trailing)))
+				block = append(append(append(header, block[n+m:len(block)-1]...), trailing...), 0)
+			}
+
+			_, err := io.ReadAll(l.NewReader(bytes.NewReader(block)))
+			return err
+		},
+	}
+
+	for name, decode := range decoders {
+		err := decode(l, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		limited := l
+		limited.MaxTokens = 10
+		err = decode(limited, nil)
+		if !errors.Is(err, ErrTooManyTokens) {
+			t.Errorf("%s: MaxTokens returned %v, want ErrTooManyTokens", name, err)
+		}
+
+		exact := l
+		exact.Trailing = TrailingExactEnd
+		err = decode(exact, []byte{0})
+		if !errors.Is(err, ErrTrailingBytes) {
+			t.Errorf("%s: a trailing byte returned %v, want ErrTrailingBytes", name, err)
+		}
+
+		//Lenient by default
+		err = decode(l, []byte{0})
+		if err != nil {
+			t.Errorf("%s: a trailing byte without TrailingExactEnd returned %v", name, err)
+		}
+	}
+}
+
+func TestGetUpperBound(t *testing.T) {
+	for name, l := range getTestConfigs() {
+		//Around every varint header size, up to the largest input
+		lengths := []uint32{0, 1, 2, 100}
+		for bits := 7; bits < 32; bits += 7 {
+			lengths = append(lengths, 1<<bits-1, 1<<bits, 1<<bits+1)
+		}
+		lengths = append(lengths, math.MaxUint32-1, math.MaxUint32)
+
+		previous := uint64(0)
+		for _, length := range lengths {
+			bound := l.GetUpperBound(length)
+			if bound < previous || bound < uint64(length)*9/8 {
+				t.Errorf("%s: the bound of %d bytes is %d, after %d", name, length, bound, previous)
+			}
+			previous = bound
+		}
+
+		//Incompressible input takes the worst case
+		input := getRandomInput(10000, 7)
+		compressed, err := l.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(len(compressed)) > l.GetUpperBound(uint32(len(input))) {
+			t.Errorf("%s: Encode wrote %d bytes, over the bound of %d", name, len(compressed), l.GetUpperBound(uint32(len(input))))
+		}
+	}
+}
+
+func TestOverlappingMatches(t *testing.T) {
+	//Every offset below the length copies bytes the match itself wrote
+	for offset := uint32(1); offset <= 8; offset += 1 {
+		for _, length := range []uint32{offset, offset + 1, 2 * offset, 63} {
+			output := append([]byte("0123456789")[:offset], make([]byte, length)...)
+			token := token{isPair: true, offset: offset, length: length}
+			token.writeTo(output, offset)
+
+			for i := offset; i < offset+length; i += 1 {
+				if output[i] != output[i-offset] {
+					t.Fatalf("a match of %d bytes at offset %d wrote %q", length, offset, output)
+				}
+			}
+		}
+	}
+
+	l := NewLzss(8, 8, 1)
+	for _, period := range []int{1, 2, 3, 7, 255} {
+		input := bytes.Repeat(getRandomInput(period, int64(period)), 4000/period)
+		compressed, err := l.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := l.Decode(compressed)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Errorf("a period of %d: %s", period, err)
+		}
+	}
+}
+
+func TestEncodePool(t *testing.T) {
+	small := readCorpus(t, "grammar.lsp")
+	l := NewLzss(10, 6, 2)
+
+	expected, err := l.Encode(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//A pooled buffer full of a bigger, incompressible stream must not leak into the next one
+	_, err = l.Encode(getRandomInput(100000, 9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := l.Encode(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(compressed, expected) {
+		t.Errorf("after another Encode wrote %d bytes that differ from the %d of the first", len(compressed), len(expected))
+	}
+}
+
+func TestMaxEncodeMemory(t *testing.T) {
+	input := readCorpus(t, "cp.html")
+	l := NewLzss(10, 6, 2)
+
+	expected, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Below the worst case, above the actual output
+	limited := l
+	limited.MaxEncodeMemory = uint32(len(expected)) + 100
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	allocated := stats.TotalAlloc
+
+	compressed, err := limited.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(compressed, expected) {
+		t.Error("the limited output differs from Encode's")
+	}
+
+	runtime.ReadMemStats(&stats)
+	if stats.TotalAlloc-allocated > uint64(limited.MaxEncodeMemory)+4096 {
+		t.Errorf("allocated %d bytes with a limit of %d", stats.TotalAlloc-allocated, limited.MaxEncodeMemory)
+	}
+
+	limited.MaxEncodeMemory = uint32(len(expected)) / 2
+	_, err = limited.Encode(input)
+	if err != ErrMemoryLimitExceeded {
+		t.Errorf("a limit below the output returned %v, want ErrMemoryLimitExceeded", err)
+	}
+
+	//Other errors are not the limit's
+	errStopped := errors.New("stopped")
+	_, err = limited.EncodeContext(stoppedContext{context.Background(), errStopped}, input)
+	if err != errStopped {
+		t.Errorf("a stopped context returned %v, want its error", err)
+	}
+}
+
+// A context whose Err is err, which isn't one of context's own
+type stoppedContext struct {
+	context.Context
+	err error
+}
+
+func (c stoppedContext) Err() error {
+	return c.err
+}
+
+func TestGetInPlaceSize(t *testing.T) {
+	l := NewLzss(10, 6, 2)
+	l.FixedLengthHeader = true
+
+	//The output fits in 32 bits, the extra eighth doesn't
+	_, err := l.GetInPlaceSize([]byte{0xff, 0xff, 0xff, 0x00, 0x00})
+	if !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("a 4 GiB output returned %v, want ErrInputTooLarge", err)
+	}
+
+	size, err := l.GetInPlaceSize([]byte{0x00, 0x00, 0x00, 0x10, 0x00})
+	if err != nil || size != 18 {
+		t.Errorf("a 16 byte output needs %d bytes, %v, want 18", size, err)
+	}
+}
+
+// The bits of the tokens parseFrom would write, with usable deciding which matches to take
+func getParseBits(l *Lzss, input []byte, usable func(m match) bool) uint64 {
+	finder := l.getMatchFinder(input, 0)
+	defer finder.release()
+
+	bits := uint64(0)
+	lookahead, lookaheadIndex := match{}, uint32(len(input))
+	for index := uint32(0); index < uint32(len(input)); {
+		found := lookahead
+		if lookaheadIndex != index {
+			found = l.getLongestMatch(input, 0, index, &finder)
+		}
+
+		if l.Lazy && usable(found) && index+1 < uint32(len(input)) {
+			lookahead, lookaheadIndex = l.getLongestMatch(input, 0, index+1, &finder), index+1
+			if usable(lookahead) && lookahead.length > found.length {
+				found = match{}
+			}
+		}
+
+		if usable(found) {
+			bits += l.getTokenBits(token{isPair: true})
+			index += found.length
+		} else {
+			bits += l.getTokenBits(token{})
+			index += 1
+		}
+	}
+
+	return bits
+}
+
+func TestMatchCost(t *testing.T) {
+	files, err := filepath.Glob("../corpus/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs := [][3]int{{10, 6, 2}, {10, 7, 2}, {12, 4, 1}, {16, 8, 1}, {14, 4, 2}, {16, 6, 2}}
+	for _, file := range files {
+		input, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input = input[:min(len(input), 300000)]
+
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			t.Parallel()
+			checkMatchCost(t, input, configs)
+		})
+	}
+}
+
+// Checks that weighing the cost of matches never parses input into more bits than taking
+// every match long enough, for each config greedy and lazy
+func checkMatchCost(t *testing.T, input []byte, configs [][3]int) {
+	for _, config := range configs {
+		for _, lazy := range []bool{false, true} {
+			l := NewLzss(byte(config[0]), byte(config[1]), uint32(config[2]))
+			l.Lazy = lazy
+
+			//Any match of minimumLength bytes, as Encode took them before weighing costs
+			threshold := getParseBits(&l, input, func(m match) bool { return m.length >= l.minimumLength && m.length > 0 })
+			bits := getParseBits(&l, input, l.isUsable)
+
+			if size := (uint64(8*l.getHeaderLength(uint32(len(input)))) + bits + 7) / 8; size != uint64(getDryRunSize(t, l, input)) {
+				t.Fatalf("%v lazy=%v: the reference parse is %d bytes, Encode's %d", config, lazy, size, getDryRunSize(t, l, input))
+			}
+
+			if bits > threshold {
+				t.Errorf("%v lazy=%v: %d bits weighing costs, %d taking every match", config, lazy, bits, threshold)
+			}
+		}
+	}
+}
+
+func TestBitOrder(t *testing.T) {
+	//A literal 'a' (0x61), then a match of offset 1 and length 3: 0 01100001 1 0001 011
+	input := []byte("aaaa")
+	l := NewLzss(4, 3, 2)
+
+	for _, c := range []struct {
+		lsbFirst bool
+		expected []byte
+	}{
+		//Bits fill each byte from the top, the last one left-justified
+		{false, []byte{0x04, 0b00110000, 0b11000101, 0b10000000}},
+		//Bits fill each byte from the bottom, every field reversed: 0 10000110 1 1000 110
+		{true, []byte{0x04, 0b11000010, 0b11000110, 0b00000000}},
+	} {
+		l.LSBFirst = c.lsbFirst
+
+		compressed, err := l.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(compressed, c.expected) {
+			t.Errorf("LSBFirst=%v encoded %08b, want %08b", c.lsbFirst, compressed, c.expected)
+		}
+
+		output, err := l.Decode(c.expected)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Errorf("LSBFirst=%v: %s", c.lsbFirst, err)
+		}
+	}
+}
+
+func TestClosestMatch(t *testing.T) {
+	//The last abcd matches 4 bytes 10 back and 5 back, cut short by X, Y and Z
+	input := []byte("abcdXabcdYabcdZ")
+
+	finders := map[string]func(l *Lzss) MatchFinder{
+		"hashchain":   func(l *Lzss) MatchFinder { return nil },
+		"scan":        (*Lzss).NewScanFinder,
+		"tree":        (*Lzss).NewTreeFinder,
+		"suffixarray": (*Lzss).NewSuffixArrayFinder,
+	}
+
+	for name, newFinder := range finders {
+		l := NewLzss(10, 6, 2)
+		l.Finder = newFinder(&l)
+
+		tokens := l.Tokens(input)
+		last := tokens[len(tokens)-2]
+		if !last.IsPair || last.Length != 4 || last.Offset != 5 {
+			t.Errorf("%s: the last abcd is %+v, want the match 5 bytes back", name, last)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	text := readCorpus(t, "asyoulik.txt")
+	inputs := [][]byte{text[:20000], text[50000:70000], getRandomInput(20000, 11), make([]byte, 20000)}
+
+	finders := map[string]func(l *Lzss) MatchFinder{
+		"hashchain":   func(l *Lzss) MatchFinder { return nil },
+		"tree":        (*Lzss).NewTreeFinder,
+		"suffixarray": (*Lzss).NewSuffixArrayFinder,
+	}
+
+	for name, newFinder := range finders {
+		l := NewLzss(14, 4, 3)
+		l.Finder = newFinder(&l)
+
+		//Every input in turn in the same buffer, so a finder that kept positions of the last one
+		//would match bytes that are no longer there
+		buffer := make([]byte, 20000)
+		for i, input := range inputs {
+			copy(buffer, input)
+			l.Reset()
+
+			compressed, err := l.Encode(buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := l.Decode(compressed)
+			if err == nil {
+				err = checkRoundTrip(input, output)
+			}
+			if err != nil {
+				t.Errorf("%s: input %d after a reset: %s", name, i, err)
+			}
+		}
+	}
+}
+
+// A MatchFinder claiming a match at one index whatever the bytes there, which Encode trusts
+type lyingFinder struct {
+	index uint32
+	match Match
+}
+
+func (f lyingFinder) FindMatch(input []byte, index uint32) Match {
+	return ternary(index == f.index, f.match, Match{})
+}
+
+func TestVerify(t *testing.T) {
+	input := make([]byte, 200)
+	for i := range input {
+		input[i] = byte(i)
+	}
+
+	l := NewLzss(10, 6, 2)
+	err := l.Verify(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//The 4 bytes 50 back from 100 are 100, 51, 52 and 53, so the output is wrong from 101
+	input[50] = 100
+	l.Finder = lyingFinder{index: 100, match: Match{Offset: 50, Length: 4}}
+
+	err = l.Verify(input)
+	if !errors.Is(err, ErrRoundTrip) || err.Error() != "Decoded output does not match the input at byte 101 (input 200 bytes, output 200)" {
+		t.Errorf("a lying finder returned %v, want ErrRoundTrip at byte 101", err)
+	}
+}
+
+func TestLatencyClass(t *testing.T) {
+	inputs := map[string][]byte{
+		"text":   readCorpus(t, "alice29.txt")[:50000],
+		"random": getRandomInput(5000, 14),
+		"runs":   bytes.Repeat([]byte("aaaaaaaaab"), 200),
+		"zeros":  make([]byte, 2000),
+	}
+
+	for _, class := range []DecodeLatencyClass{LatencyBounded, LatencyRealtime} {
+		for _, l := range []Lzss{NewLzss(10, 6, 2), NewLzss(14, 8, 1)} {
+			l.LatencyClass = class
+
+			for name, input := range inputs {
+				tokens := l.Tokens(input)
+
+				//At most a token and 9 bits per output byte
+				bits := uint64(0)
+				for _, token := range tokens {
+					bits += ternary(token.IsPair, 1+uint64(l.offsetBits)+uint64(l.lengthBits), 9)
+					if token.IsPair && bits > 9*uint64(token.Index+token.Length) {
+						t.Fatalf("class %d, %s: %d bits by byte %d", class, name, bits, token.Index+token.Length)
+					}
+
+					if class == LatencyRealtime && token.IsPair && (token.Length > latencyRealtimeLength || token.Offset < token.Length) {
+						t.Fatalf("class %d, %s: a match of %d bytes %d back", class, name, token.Length, token.Offset)
+					}
+				}
+				if len(tokens) > len(input) {
+					t.Errorf("class %d, %s: %d tokens for %d bytes", class, name, len(tokens), len(input))
+				}
+
+				err := l.Verify(input)
+				if err != nil {
+					t.Errorf("class %d, %s: %s", class, name, err)
+				}
+			}
+		}
+	}
+}
+
+// Walks a checkpointed stream to the first match at or after start, returning the bit where it
+// starts and the output bytes the checkpoint after it covers
+func findCheckpointedMatch(t *testing.T, l Lzss, compressed []byte, start uint32) (uint64, token, [2]uint32) {
+	t.Helper()
+
+	stream := l.newBitStream(compressed)
+	interval, err := stream.read7BitUint32()
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalLength, err := l.readHeader(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bit, found := uint64(0), token{}
+	hashed, next := uint32(0), interval
+	for index := uint32(0); index < originalLength; {
+		position := stream.getBitsRead()
+		token, err := l.readToken(&stream)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !found.isPair && token.isPair && index >= start && token.offset > 1 && token.offset < index {
+			bit, found = position, token
+		}
+
+		index += token.length
+		if index < next && index < originalLength {
+			continue
+		}
+
+		_, err = stream.readUint32(32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.isPair {
+			return bit, found, [2]uint32{hashed, index}
+		}
+		hashed, next = index, (index/interval+1)*interval
+	}
+
+	t.Fatalf("no match after byte %d", start)
+	return 0, token{}, [2]uint32{}
+}
+
+func TestCheckpoints(t *testing.T) {
+	input := readCorpus(t, "alice29.txt")[:50000]
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.EncodeWithCheckpoints(input, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := l.DecodeWithCheckpoints(compressed)
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//A match moved a byte further back still decodes, to the wrong bytes, which the next
+	//checkpoint catches
+	bit, _, covered := findCheckpointedMatch(t, l, compressed, 20000)
+	corrupt := bytes.Clone(compressed)
+	bit += uint64(l.offsetBits)
+	corrupt[bit/8] ^= 0x80 >> (bit % 8)
+
+	_, err = l.DecodeWithCheckpoints(corrupt)
+	expected := fmt.Sprintf("bytes %d to %d", covered[0], covered[1])
+	if !errors.Is(err, ErrCheckpointMismatch) || !strings.HasSuffix(err.Error(), expected) {
+		t.Errorf("a corrupt match at bit %d returned %v, want ErrCheckpointMismatch for %s", bit, err, expected)
+	}
+
+	//A match reaching before the output is a corrupt stream, not a failed checkpoint
+	bit, _, _ = findCheckpointedMatch(t, l, compressed, 0)
+	corrupt = bytes.Clone(compressed)
+	corrupt[(bit+1)/8] ^= 0x80 >> ((bit + 1) % 8)
+
+	_, err = l.DecodeWithCheckpoints(corrupt)
+	if !errors.Is(err, ErrInvalidBackReference) {
+		t.Errorf("a match reaching before the output returned %v, want ErrInvalidBackReference", err)
+	}
+
+	limited := l
+	limited.MaxTokens = 100
+	_, err = limited.DecodeWithCheckpoints(compressed)
+	if !errors.Is(err, ErrTooManyTokens) {
+		t.Errorf("MaxTokens of 100 returned %v, want ErrTooManyTokens", err)
+	}
+
+	exact := l
+	exact.Trailing = TrailingExactEnd
+	_, err = exact.DecodeWithCheckpoints(append(bytes.Clone(compressed), 0))
+	if !errors.Is(err, ErrTrailingBytes) {
+		t.Errorf("a trailing byte returned %v, want ErrTrailingBytes", err)
+	}
+}
+
+func TestBytewise(t *testing.T) {
+	input := readCorpus(t, "fields.c")
+
+	for name, l := range getTestConfigs() {
+		compressed, err := l.EncodeBytewise(input)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		output, err := l.DecodeBytewise(compressed)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	//"aaaa" is a literal and a match of 3 one byte back
+	l := NewLzss(10, 6, 2)
+	corrupt := map[string]struct {
+		input    []byte
+		expected error
+	}{
+		"flag 2":             {[]byte{4, 0, 'a', 2, 1, 3}, ErrCorrupt},
+		"flag 0xff":          {[]byte{4, 0xff, 'a', 1, 1, 3}, ErrCorrupt},
+		"truncated token":    {[]byte{4, 0, 'a', 1}, ErrUnexpectedEOF},
+		"truncated varint":   {[]byte{4, 0, 'a', 1, 0x81}, ErrUnexpectedEOF},
+		"overflowing varint": {[]byte{4, 0, 'a', 1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 1, 3}, ErrCorrupt},
+		"offset past output": {[]byte{4, 0, 'a', 1, 2, 3}, ErrInvalidBackReference},
+		"zero offset":        {[]byte{4, 0, 'a', 1, 0, 3}, ErrInvalidBackReference},
+		"length past end":    {[]byte{4, 0, 'a', 1, 1, 4}, ErrInvalidBackReference},
+		"bad header":         {[]byte{0x80}, ErrCorrupt},
+	}
+
+	output, err := l.DecodeBytewise([]byte{4, 0, 'a', 1, 1, 3})
+	if err != nil || string(output) != "aaaa" {
+		t.Fatalf("the valid stream returned %q, %v", output, err)
+	}
+
+	for name, c := range corrupt {
+		_, err := l.DecodeBytewise(c.input)
+		if !errors.Is(err, c.expected) {
+			t.Errorf("%s: returned %v, want %v", name, err, c.expected)
+		}
+	}
+}
+
+func TestBottleneck(t *testing.T) {
+	//A counter byte after each "abc" leaves only 3 byte matches
+	var short []byte
+	for i := 0; i < 256; i += 1 {
+		short = append(short, 'a', 'b', 'c', byte(i))
+	}
+
+	cases := map[string]struct {
+		input    []byte
+		l        Lzss
+		expected string
+	}{
+		"offset":  {bytes.Repeat(getRandomInput(1000, 14), 3), NewLzss(8, 8, 2), "maxOffset too small"},
+		"length":  {bytes.Repeat(getRandomInput(200, 15), 10), NewLzss(12, 2, 2), "maximumLength too small"},
+		"minimum": {short, NewLzss(8, 8, 8), "minimumLength too high"},
+		"none":    {getRandomInput(2000, 16), NewLzss(12, 4, 2), "no bottleneck"},
+	}
+
+	for name, c := range cases {
+		bottleneck := Bottleneck(c.input, c.l)
+		if !strings.HasPrefix(bottleneck, c.expected) {
+			t.Errorf("%s: Bottleneck returned %q, want %q", name, bottleneck, c.expected)
+		}
+	}
+}
+
+func TestCompressFile(t *testing.T) {
+	input := readCorpus(t, "grammar.lsp")
+	l := NewLzss(10, 6, 2)
+
+	path := filepath.Join(t.TempDir(), "grammar.lsp")
+	err := os.WriteFile(path, input, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	err = os.Chtimes(path, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := l.CompressFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := l.DecompressFile(archive, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "grammar.lsp" || !info.ModTime().Equal(modTime) {
+		t.Errorf("restored %s modified %s, want grammar.lsp modified %s", info.Name(), info.ModTime(), modTime)
+	}
+
+	output, err := os.ReadFile(restored)
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Longer than a one byte length and than most file systems allow
+	header := &FileHeader{Name: strings.Repeat("long name ", 100), ModTime: modTime}
+	archive, err = l.EncodeWithHeader(input, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, decoded, err := l.DecodeWithHeader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Name != header.Name || !decoded.ModTime.Equal(modTime) {
+		t.Errorf("a %d byte name came back as %d bytes modified %s", len(header.Name), len(decoded.Name), decoded.ModTime)
+	}
+
+	//Cut in the name length, the name and the modification time
+	for _, length := range []int{1, 2, 3, 500, 1003, 1009} {
+		_, _, err = l.DecodeWithHeader(archive[:length])
+		if !errors.Is(err, ErrUnexpectedEOF) {
+			t.Errorf("a header cut at %d bytes returned %v, want ErrUnexpectedEOF", length, err)
+		}
+	}
+
+	archive, err = l.EncodeWithHeader(input, &FileHeader{Name: "../escape"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = l.DecompressFile(archive, t.TempDir())
+	if err == nil {
+		t.Error("DecompressFile wrote a name outside of its directory")
+	}
+}
+
+func TestDecodeBuffer(t *testing.T) {
+	input := readCorpus(t, "xargs.1")
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBufferString("prefix")
+	err = l.DecodeBuffer(compressed, buf)
+	if err == nil {
+		err = l.DecodeBuffer(compressed, buf)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := append(append([]byte("prefix"), input...), input...)
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("buf holds %d bytes, want the prefix and the output twice, %d bytes", buf.Len(), len(expected))
+	}
+
+	//A corrupt stream leaves what buf held
+	_, err = l.Decode(compressed[:len(compressed)/2])
+	if err == nil {
+		t.Fatal("a truncated stream decoded")
+	}
+	err = l.DecodeBuffer(compressed[:len(compressed)/2], buf)
+	if err == nil || !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("a truncated stream returned %v and left %d bytes", err, buf.Len())
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf.Reset()
+		l.DecodeBuffer(compressed, buf)
+	})
+	if allocs != 0 {
+		t.Errorf("DecodeBuffer into a reset buf allocated %v times", allocs)
+	}
+}
+
+func TestFailIncompressible(t *testing.T) {
+	text, random := readCorpus(t, "fields.c"), getRandomInput(5000, 17)
+	l := NewLzss(10, 6, 2)
+	l.FailIncompressible = true
+
+	encoders := map[string]func(l Lzss, input []byte) error{
+		"Encode": func(l Lzss, input []byte) error {
+			_, err := l.Encode(input)
+			return err
+		},
+		"EncodeTo": func(l Lzss, input []byte) error {
+			_, err := l.EncodeTo(make([]byte, l.GetUpperBound(uint32(len(input)))), input)
+			return err
+		},
+		"EncodeAppend": func(l Lzss, input []byte) error {
+			_, err := l.EncodeAppend(nil, input)
+			return err
+		},
+		"EncodeRaw": func(l Lzss, input []byte) error {
+			_, err := l.EncodeRaw(input)
+			return err
+		},
+		"EncodeParallel": func(l Lzss, input []byte) error {
+			_, err := l.EncodeParallel(input)
+			return err
+		},
+		"Codec.Compress": func(l Lzss, input []byte) error {
+			_, err := NewCodec(l).Compress(nil, input)
+			return err
+		},
+		"Codec.Compress into dst": func(l Lzss, input []byte) error {
+			_, err := NewCodec(l).Compress(make([]byte, l.GetUpperBound(uint32(len(input)))), input)
+			return err
+		},
+	}
+
+	for name, encode := range encoders {
+		err := encode(l, text)
+		if err != nil {
+			t.Errorf("%s: text returned %v", name, err)
+		}
+
+		err = encode(l, random)
+		if !errors.Is(err, ErrIncompressible) {
+			t.Errorf("%s: random input returned %v, want ErrIncompressible", name, err)
+		}
+	}
+
+	//The Codec's scratch buffer is bounded by MaxEncodeMemory as Encode's is
+	codec := NewCodec(NewLzss(10, 6, 2))
+	expected, err := codec.Lzss.Encode(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec.Lzss.MaxEncodeMemory = uint32(len(expected)) + 100
+	compressed, err := codec.Compress(nil, text)
+	if err != nil || !bytes.Equal(compressed, expected) {
+		t.Errorf("a limit above the output returned %d bytes, %v", len(compressed), err)
+	}
+
+	codec.Lzss.MaxEncodeMemory = uint32(len(expected)) / 2
+	_, err = codec.Compress(nil, text)
+	if !errors.Is(err, ErrMemoryLimitExceeded) {
+		t.Errorf("a limit below the output returned %v, want ErrMemoryLimitExceeded", err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := NewLzss(10, 6, 2)
+
+	//Each changes the stream format, so no two may share a fingerprint
+	formats := map[string]Lzss{"base": base}
+	formats["offsetBits"] = NewLzss(11, 6, 2)
+	formats["lengthBits"] = NewLzss(10, 5, 2)
+	formats["minimumLength"] = NewLzss(10, 6, 3)
+	for name, set := range map[string]func(l *Lzss){
+		"FixedLengthHeader": func(l *Lzss) { l.FixedLengthHeader = true },
+		"BiasedLength":      func(l *Lzss) { l.BiasedLength = true },
+		"SelfDescribing":    func(l *Lzss) { l.SelfDescribing = true },
+		"LSBFirst":          func(l *Lzss) { l.LSBFirst = true },
+	} {
+		l := base
+		set(&l)
+		formats[name] = l
+	}
+
+	seen := map[uint32]string{}
+	for name, l := range formats {
+		fingerprint := l.Fingerprint()
+		if other, found := seen[fingerprint]; found {
+			t.Errorf("%s and %s share the fingerprint %08x", name, other, fingerprint)
+		}
+		seen[fingerprint] = name
+	}
+
+	//How a stream is parsed or checked is not its format
+	same := base
+	same.Lazy, same.Optimal, same.MaxTokens, same.Trailing = true, true, 100000, TrailingExactEnd
+	if same.Fingerprint() != base.Fingerprint() {
+		t.Error("parse and decode options change the fingerprint")
+	}
+
+	input := readCorpus(t, "grammar.lsp")
+	compressed, err := base.EncodeWithFingerprint(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := same.DecodeWithFingerprint(compressed)
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, l := range formats {
+		if name == "base" {
+			continue
+		}
+
+		_, err := l.DecodeWithFingerprint(compressed)
+		if !errors.Is(err, ErrConfigMismatch) {
+			t.Errorf("%s: returned %v, want ErrConfigMismatch", name, err)
+		}
+	}
+
+	_, err = base.DecodeWithFingerprint(compressed[:3])
+	if !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("a cut fingerprint returned %v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestAlignHint(t *testing.T) {
+	//At byte 10 "abcde" is 10 bytes back and "abcd" 4 bytes back
+	input := []byte("abcdeQabcdabcde!")
+
+	l := NewLzss(10, 6, 2)
+	aligned := l
+	aligned.AlignHint = 4
+
+	expected := map[string]token{
+		"unaligned": {isPair: true, offset: 10, length: 5},
+		"aligned":   {isPair: true, offset: 4, length: 4},
+	}
+
+	for name, l := range map[string]Lzss{"unaligned": l, "aligned": aligned} {
+		var found token
+		index := uint32(0)
+		l.parse(input, func(token token) error {
+			if index == 10 {
+				found = token
+			}
+			index += token.length
+			return nil
+		})
+
+		if found != expected[name] {
+			t.Errorf("%s: the match at byte 10 is %+v, want %+v", name, found, expected[name])
+		}
+	}
+
+	for _, input := range [][]byte{input, readCorpus(t, "sum")} {
+		compressed, err := aligned.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := l.Decode(compressed)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestFixedLengthHeader(t *testing.T) {
+	l := NewLzss(10, 6, 2)
+	l.FixedLengthHeader = true
+	lsbFirst := l
+	lsbFirst.LSBFirst = true
+
+	//The header, then the first literal flag bit, 0, and 7 bits of 'a', 0x61: the top ones, or
+	//with LSBFirst the low ones shifted up past the flag
+	cases := []struct {
+		l        Lzss
+		input    []byte
+		expected []byte
+	}{
+		{l, []byte("abc"), []byte{0, 0, 0, 3, 0x30}},
+		{l, append([]byte("a"), make([]byte, 0x12345)...), []byte{0, 1, 0x23, 0x46, 0x30}},
+		{lsbFirst, []byte("abc"), []byte{3, 0, 0, 0, 0xc2}},
+		{lsbFirst, append([]byte("a"), make([]byte, 0x12345)...), []byte{0x46, 0x23, 1, 0, 0xc2}},
+	}
+
+	for _, c := range cases {
+		compressed, err := c.l.Encode(c.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.HasPrefix(compressed, c.expected) {
+			t.Errorf("LSBFirst %v: %d bytes start with % x, want % x", c.l.LSBFirst, len(c.input), compressed[:len(c.expected)], c.expected)
+		}
+
+		originalLength, err := c.l.GetOriginalLength(compressed)
+		if err != nil || originalLength != uint32(len(c.input)) {
+			t.Errorf("LSBFirst %v: the header reads %d, %v, want %d", c.l.LSBFirst, originalLength, err, len(c.input))
+		}
+	}
+}
+
+// Writes tokens as a stream, whichever tokens they are, for decoders to be given streams
+// Encode would never write
+func writeTestStream(t *testing.T, l Lzss, tokens []token) []byte {
+	t.Helper()
+
+	originalLength := uint32(0)
+	for _, token := range tokens {
+		originalLength += token.length
+	}
+
+	stream := l.newBitStream(make([]byte, l.GetUpperBound(originalLength)+uint64(9*len(tokens))))
+	err := l.writeHeader(&stream, originalLength)
+	for _, token := range tokens {
+		if err == nil {
+			err = l.writeToken(&stream, token)
+		}
+	}
+	if err == nil {
+		err = stream.flush()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stream.buffer[:stream.bufferPosition]
+}
+
+func TestCanonicalDecode(t *testing.T) {
+	//A 2 byte match takes 21 bits, 3 more than its literals
+	l := NewLzss(16, 4, 2)
+	input := []byte("abab")
+
+	canonical, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := l.CanonicalDecode(canonical)
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Every one decodes to input
+	padded := bytes.Clone(canonical)
+	padded[len(padded)-1] |= 1
+
+	streams := map[string][]byte{
+		"expensive match": writeTestStream(t, l, []token{
+			{literal: 'a', length: 1}, {literal: 'b', length: 1}, {isPair: true, offset: 2, length: 2},
+		}),
+		"padding bits":  padded,
+		"trailing byte": append(bytes.Clone(canonical), 0),
+	}
+
+	for name, stream := range streams {
+		output, err := l.Decode(stream)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		_, err = l.CanonicalDecode(stream)
+		if !errors.Is(err, ErrNonCanonical) {
+			t.Errorf("%s: CanonicalDecode returned %v, want ErrNonCanonical", name, err)
+		}
+	}
+
+	_, err = l.CanonicalDecode([]byte{0})
+	if !errors.Is(err, ErrNonCanonical) {
+		t.Errorf("a header declaring 0 bytes returned %v, want ErrNonCanonical", err)
+	}
+}
+
+func TestNoOverlap(t *testing.T) {
+	inputs := map[string][]byte{
+		"text":  readCorpus(t, "alice29.txt")[:20000],
+		"runs":  bytes.Repeat([]byte("aaaaaaaaab"), 200),
+		"zeros": make([]byte, 2000),
+	}
+
+	configs := getTestConfigs()
+	tree := NewLzss(12, 4, 2)
+	tree.Finder = tree.NewTreeFinder()
+	configs["tree"] = tree
+
+	for name, l := range configs {
+		l.NoOverlap = true
+
+		for inputName, input := range inputs {
+			matches := 0
+			l.parse(input, func(token token) error {
+				if token.isPair && token.offset < token.length {
+					t.Errorf("%s, %s: a match of %d bytes %d bytes back overlaps", name, inputName, token.length, token.offset)
+				}
+				matches += ternary(token.isPair, 1, 0)
+				return nil
+			})
+			//A Finder's closest match in a run is cut to its offset, too short to keep
+			if matches == 0 && (l.Finder == nil || inputName == "text") {
+				t.Errorf("%s, %s: no matches", name, inputName)
+			}
+
+			compressed, err := l.Encode(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := l.Decode(compressed)
+			if err == nil {
+				err = checkRoundTrip(input, output)
+			}
+			if err != nil {
+				t.Errorf("%s, %s: %s", name, inputName, err)
+			}
+		}
+	}
+}
+
+func TestDecodeAt(t *testing.T) {
+	input := readCorpus(t, "xargs.1")
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefixes := map[string][]byte{
+		"none":  {},
+		"BOM":   {0xef, 0xbb, 0xbf},
+		"magic": []byte("LZSSv1\x00\x00"),
+	}
+
+	for name, prefix := range prefixes {
+		output, err := l.DecodeAt(append(bytes.Clone(prefix), compressed...), uint32(len(prefix)))
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	//Up to the end is an empty stream, past it an error
+	output, err := l.DecodeAt(compressed, uint32(len(compressed)))
+	if err != nil || len(output) != 0 {
+		t.Errorf("skipping the whole input returned %d bytes, %v", len(output), err)
+	}
+
+	for _, offset := range []uint32{uint32(len(compressed)) + 1, math.MaxUint32} {
+		_, err = l.DecodeAt(compressed, offset)
+		if err == nil {
+			t.Errorf("skipping %d bytes of %d decoded", offset, len(compressed))
+		}
+	}
+}
+
+func TestEncodeTo(t *testing.T) {
+	inputs := [][]byte{{1}, readCorpus(t, "grammar.lsp"), getRandomInput(2000, 18), make([]byte, 10000)}
+
+	for name, l := range getTestConfigs() {
+		for _, input := range inputs {
+			expected, err := l.Encode(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			size, err := l.ExactCompressedSize(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != uint32(len(expected)) {
+				t.Errorf("%s: ExactCompressedSize of %d bytes is %d, Encode wrote %d", name, len(input), size, len(expected))
+				continue
+			}
+
+			dst := make([]byte, size)
+			n, err := l.EncodeTo(dst, input)
+			if err != nil || !bytes.Equal(dst[:n], expected) || n != len(dst) {
+				t.Errorf("%s: EncodeTo an exact dst wrote %d of %d bytes, %v", name, n, len(dst), err)
+			}
+
+			_, err = l.EncodeTo(dst[:size-1], input)
+			if !errors.Is(err, ErrShortBuffer) {
+				t.Errorf("%s: EncodeTo a dst one byte short returned %v, want ErrShortBuffer", name, err)
+			}
+		}
+	}
+}
+
+func TestBiasedLength(t *testing.T) {
+	input := append(readCorpus(t, "grammar.lsp"), make([]byte, 1000)...)
+
+	l := NewLzss(10, 4, 3)
+	biased := l
+	biased.BiasedLength = true
+
+	//The 4 bit field holds lengths up to 15, or 3 to 18 biased
+	for name, c := range map[string]struct {
+		l       Lzss
+		longest uint32
+	}{"plain": {l, 15}, "biased": {biased, 18}} {
+		longest := uint32(0)
+		c.l.parse(input, func(token token) error {
+			longest = max(longest, ternary(token.isPair, token.length, 0))
+			return nil
+		})
+		if longest != c.longest {
+			t.Errorf("%s: the longest match is %d bytes, want %d", name, longest, c.longest)
+		}
+
+		compressed, err := c.l.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := c.l.Decode(compressed)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	//Fewer tokens for the zeros
+	plainSize, biasedSize := getDryRunSize(t, l, input), getDryRunSize(t, biased, input)
+	if biasedSize >= plainSize {
+		t.Errorf("BiasedLength wrote %d bytes, %d without", biasedSize, plainSize)
+	}
+}
+
+func TestEncodeWithChecksum(t *testing.T) {
+	input := readCorpus(t, "xargs.1")[:1500]
+	l := NewLzss(10, 6, 2)
+
+	compressed, err := l.EncodeWithChecksum(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := l.DecodeWithChecksum(compressed)
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//A flipped bit may still decode to input, through a match of the same bytes or in the
+	//padding, but never to anything else
+	mismatches := 0
+	for bit := 0; bit < 8*len(compressed); bit += 1 {
+		corrupt := bytes.Clone(compressed)
+		corrupt[bit/8] ^= 0x80 >> (bit % 8)
+
+		output, err := l.DecodeWithChecksum(corrupt)
+		if err == nil && !bytes.Equal(output, input) {
+			t.Fatalf("flipping bit %d decoded to other bytes without an error", bit)
+		}
+		mismatches += ternary(errors.Is(err, ErrChecksumMismatch), 1, 0)
+	}
+
+	if mismatches == 0 {
+		t.Error("no flipped bit was caught by the checksum")
+	}
+}
+
+func TestDecodeAuto(t *testing.T) {
+	input := readCorpus(t, "grammar.lsp")
+
+	configs := map[string]Lzss{
+		"10,6,2": NewLzss(10, 6, 2),
+		"16,4,3": NewLzss(16, 4, 3),
+		"8,8,1":  NewLzss(8, 8, 1),
+	}
+	for name, set := range map[string]func(l *Lzss){
+		"FixedLengthHeader": func(l *Lzss) { l.FixedLengthHeader = true },
+		"BiasedLength":      func(l *Lzss) { l.BiasedLength = true },
+		"LSBFirst":          func(l *Lzss) { l.LSBFirst = true },
+	} {
+		l := NewLzss(12, 4, 2)
+		set(&l)
+		configs[name] = l
+	}
+
+	var described []byte
+	for name, l := range configs {
+		l.SelfDescribing = true
+
+		compressed, err := l.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		described = compressed
+
+		output, err := DecodeAuto(compressed)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		//Decode checks the header against its own configuration
+		other := NewLzss(11, 5, 2)
+		other.SelfDescribing = true
+		_, err = other.Decode(compressed)
+		if !errors.Is(err, ErrConfigMismatch) {
+			t.Errorf("%s: Decode with another configuration returned %v, want ErrConfigMismatch", name, err)
+		}
+	}
+
+	plain := NewLzss(10, 6, 2)
+	compressed, err := plain.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = DecodeAuto(compressed)
+	if !errors.Is(err, ErrNotSelfDescribing) {
+		t.Errorf("a stream without a header returned %v, want ErrNotSelfDescribing", err)
+	}
+
+	//Versions and flags this decoder doesn't know have no sentinel, any error will do
+	corrupt := map[string]struct {
+		corrupt  func(header []byte) []byte
+		expected error
+	}{
+		"bad magic":       {func(header []byte) []byte { header[1] = 'Y'; return header }, ErrNotSelfDescribing},
+		"truncated":       {func(header []byte) []byte { return header[:descriptionLength-1] }, ErrNotSelfDescribing},
+		"invalid config":  {func(header []byte) []byte { header[3] = 0; return header }, ErrInvalidConfig},
+		"unknown version": {func(header []byte) []byte { header[2] = descriptionVersion + 1; return header }, nil},
+		"unknown flags":   {func(header []byte) []byte { header[9] |= 0x80; return header }, nil},
+	}
+
+	for name, c := range corrupt {
+		_, err := DecodeAuto(c.corrupt(bytes.Clone(described)))
+		if err == nil || c.expected != nil && !errors.Is(err, c.expected) {
+			t.Errorf("%s: returned %v, want %v", name, err, ternary[any](c.expected == nil, "an error", c.expected))
+		}
+	}
+}
+
+func TestEncodeString(t *testing.T) {
+	inputs := []string{
+		"",
+		"ascii",
+		"héllo wörld, ça va? ñandú",
+		"日本語のテキスト、日本語のテキスト",
+		"emoji 🎉🎉🎉 and a zwj family 👩‍👩‍👧‍👦👩‍👩‍👧‍👦",
+		strings.Repeat("Ωμέγα ", 200),
+		"invalid \xff\xfe utf-8 and a \x00 byte",
+	}
+
+	for name, l := range getTestConfigs() {
+		for _, input := range inputs {
+			compressed, err := l.EncodeString(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := l.DecodeString(compressed)
+			if err != nil || output != input {
+				t.Errorf("%s: %q decoded to %q, %v", name, input, output, err)
+			}
+		}
+	}
+}
+
+func TestEncodeContext(t *testing.T) {
+	input := readCorpus(t, "alice29.txt")
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	for name, l := range getTestConfigs() {
+		compressed, err := l.EncodeContext(context.Background(), input)
+		if err == nil {
+			var output []byte
+			output, err = l.Decode(compressed)
+			if err == nil {
+				err = checkRoundTrip(input, output)
+			}
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+
+		_, err = l.EncodeContext(cancelled, input)
+		if err != context.Canceled {
+			t.Errorf("%s: a cancelled context returned %v, want context.Canceled", name, err)
+		}
+
+		_, err = l.EncodeContext(expired, input)
+		if err != context.DeadlineExceeded {
+			t.Errorf("%s: an expired context returned %v, want context.DeadlineExceeded", name, err)
+		}
+	}
+
+	//Cancelled while encoding, at the first progress report
+	l := NewLzss(10, 6, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l.OnProgress = func(done, total, written uint32) { cancel() }
+
+	_, err := l.EncodeContext(ctx, input)
+	if err != context.Canceled {
+		t.Errorf("a context cancelled while encoding returned %v, want context.Canceled", err)
+	}
+}
+
+func TestEncodeWithDict(t *testing.T) {
+	//Small JSON messages sharing their keys, the case dictionaries are for
+	dict := []byte(`{"id": 0, "name": "", "email": "", "created_at": "2024-01-01T00:00:00Z", "active": true}`)
+	input := []byte(`{"id": 4211, "name": "Ada", "email": "ada@example.com", "created_at": "2024-03-09T10:12:44Z", "active": false}`)
+	l := NewLzss(10, 6, 2)
+
+	plain, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, err := l.EncodeWithDict(input, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(plain)*3/4 {
+		t.Errorf("EncodeWithDict wrote %d bytes, Encode %d", len(compressed), len(plain))
+	}
+
+	output, err := l.DecodeWithDict(compressed, dict)
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Only the last maxOffset bytes of the dictionary count
+	long := append(getRandomInput(5000, 19), dict...)
+	compressed, err = l.EncodeWithDict(input, long)
+	if err == nil {
+		output, err = l.DecodeWithDict(compressed, long[len(long)-int(l.maxOffset):])
+	}
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, err = l.EncodeWithDict(input, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Without it the matches reach before the output, with another the bytes are wrong
+	_, err = l.DecodeWithDict(compressed, nil)
+	if !errors.Is(err, ErrInvalidBackReference) {
+		t.Errorf("no dictionary returned %v, want ErrInvalidBackReference", err)
+	}
+
+	output, err = l.DecodeWithDict(compressed, bytes.ToUpper(dict))
+	if err != nil || bytes.Equal(output, input) {
+		t.Errorf("another dictionary decoded the input, or failed with %v", err)
+	}
+}
+
+func TestEncodeRaw(t *testing.T) {
+	input := readCorpus(t, "grammar.lsp")
+
+	for name, l := range getTestConfigs() {
+		raw, err := l.EncodeRaw(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		//Encode without its header
+		compressed, err := l.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasSuffix(compressed, raw) || len(compressed)-len(raw) != int(l.getHeaderLength(uint32(len(input)))) {
+			t.Errorf("%s: %d raw bytes are not the %d byte stream without its header", name, len(raw), len(compressed))
+		}
+
+		output, err := l.DecodeRaw(raw, uint32(len(input)))
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	l := NewLzss(10, 6, 2)
+	raw, err := l.EncodeRaw(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Longer runs out of tokens, shorter leaves some over, which only TrailingExactEnd notices
+	_, err = l.DecodeRaw(raw, uint32(len(input))+100)
+	if !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("a longer length returned %v, want ErrUnexpectedEOF", err)
+	}
+
+	exact := l
+	exact.Trailing = TrailingExactEnd
+	_, err = exact.DecodeRaw(raw, uint32(len(input))/2)
+	if err == nil {
+		t.Error("a shorter length decoded with TrailingExactEnd")
+	}
+
+	_, err = l.DecodeRaw(raw, math.MaxUint32)
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("a length no stream this short holds returned %v, want ErrCorrupt", err)
+	}
+}
+
+func TestVarint(t *testing.T) {
+	l := NewLzss(10, 6, 2)
+
+	for _, number := range []uint64{1, 127, 128, 1<<28 - 1, math.MaxUint32, 1 << 32, 1 << 35, 1<<63 + 5, math.MaxUint64} {
+		stream := l.newBitStream(make([]byte, 10))
+		err := stream.write7BitUint64(number)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		written := stream.buffer[:stream.bufferPosition]
+		if !bytes.Equal(written, binary.AppendUvarint(nil, number)) {
+			t.Errorf("%d was written as % x, not as binary.AppendUvarint's % x", number, written, binary.AppendUvarint(nil, number))
+		}
+
+		stream = l.newBitStream(written)
+		read, err := stream.read7BitUint64()
+		if err != nil || read != number {
+			t.Errorf("%d read back as %d, %v", number, read, err)
+		}
+
+		//Only the 32-bit reader minds the top bits
+		stream = l.newBitStream(written)
+		read32, err := stream.read7BitUint32()
+		if number <= math.MaxUint32 && (err != nil || uint64(read32) != number) {
+			t.Errorf("%d read back as %d, %v with the 32-bit reader", number, read32, err)
+		}
+		if number > math.MaxUint32 && !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%d returned %v with the 32-bit reader, want ErrCorrupt", number, err)
+		}
+	}
+
+	invalid := map[string]struct {
+		varint   []byte
+		expected error
+	}{
+		"truncated":       {[]byte{0x80}, ErrUnexpectedEOF},
+		"truncated 64":    {[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, ErrUnexpectedEOF},
+		"10th byte of 2":  {[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}, ErrCorrupt},
+		"11 bytes":        {[]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x81, 0x00}, ErrCorrupt},
+		"overlong zeroes": {[]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80}, ErrCorrupt},
+	}
+
+	for name, c := range invalid {
+		stream := l.newBitStream(c.varint)
+		_, err := stream.read7BitUint64()
+		if !errors.Is(err, c.expected) {
+			t.Errorf("%s: returned %v, want %v", name, err, c.expected)
+		}
+	}
+
+	//A length header of 2^32 is no stream's
+	_, err := l.Decode(append(binary.AppendUvarint(nil, 1<<32), 0, 0))
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("a header of 2^32 bytes returned %v, want ErrCorrupt", err)
+	}
+}
+
+func TestRuns(t *testing.T) {
+	configs := map[string]Lzss{
+		"10,6,2": NewLzss(10, 6, 2),
+		"14,4,3": NewLzss(14, 4, 3),
+		"16,8,1": NewLzss(16, 8, 1),
+	}
+	lazy := NewLzss(12, 4, 2)
+	lazy.Lazy = true
+	configs["lazy"] = lazy
+
+	//A literal, then matches one byte back of maximumLength bytes, the last one 1 byte short
+	const runs = 300
+	for name, l := range configs {
+		input := make([]byte, runs*l.getMaximumLength())
+
+		tokens := 0
+		l.parse(input, func(token token) error {
+			if tokens > 0 && (!token.isPair || token.offset != 1) {
+				t.Fatalf("%s: token %d is %+v, want a match 1 byte back", name, tokens, token)
+			}
+			tokens += 1
+			return nil
+		})
+		if tokens != runs+1 {
+			t.Errorf("%s: %d zeros took %d tokens, want %d", name, len(input), tokens, runs+1)
+		}
+
+		compressed, err := l.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, err := l.Decode(compressed)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
+
+func TestOptimal(t *testing.T) {
+	inputs := map[string][]byte{
+		"text":   readCorpus(t, "alice29.txt")[:30000],
+		"code":   readCorpus(t, "fields.c"),
+		"random": getRandomInput(3000, 20),
+		"runs":   bytes.Repeat([]byte("aaaaaaaaab"), 300),
+	}
+
+	//Greedy takes "abc" and then "defgh", 2 matches, where a literal and "bcdefgh" is 8 bits
+	//less. Random bytes stand for the letters and keep the blocks from matching each other
+	var crafted []byte
+	random := getRandomInput(100*14, 21)
+	for i := 0; i < len(random); i += 14 {
+		letters, separators := random[i:i+8], random[i+8:i+14]
+		crafted = append(crafted, letters[:3]...)
+		crafted = append(crafted, separators[:3]...)
+		crafted = append(crafted, letters[1:]...)
+		crafted = append(crafted, separators[3:]...)
+		crafted = append(crafted, letters...)
+	}
+	inputs["crafted"] = crafted
+
+	for _, l := range []Lzss{NewLzss(10, 6, 2), NewLzss(12, 4, 3), NewLzss(8, 8, 1)} {
+		lazy, optimal := l, l
+		lazy.Lazy = true
+		optimal.Optimal = true
+
+		for name, input := range inputs {
+			greedySize, lazySize, optimalSize := getDryRunSize(t, l, input), getDryRunSize(t, lazy, input), getDryRunSize(t, optimal, input)
+			if optimalSize > greedySize || optimalSize > lazySize {
+				t.Errorf("%d,%d,%d, %s: Optimal wrote %d bytes, greedy %d, Lazy %d", l.offsetBits, l.lengthBits, l.minimumLength, name, optimalSize, greedySize, lazySize)
+			}
+		}
+	}
+
+	l := NewLzss(10, 6, 2)
+	optimal := l
+	optimal.Optimal = true
+
+	greedySize, optimalSize := getDryRunSize(t, l, crafted), getDryRunSize(t, optimal, crafted)
+	if optimalSize+100 > greedySize {
+		t.Errorf("Optimal wrote %d bytes of the crafted input, greedy %d, want a byte less per block", optimalSize, greedySize)
+	}
+
+	compressed, err := optimal.Encode(crafted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := l.Decode(compressed)
+	if err == nil {
+		err = checkRoundTrip(crafted, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeFrames(t *testing.T) {
+	inputs := [][]byte{readCorpus(t, "grammar.lsp"), {}, []byte("a"), getRandomInput(300, 22), readCorpus(t, "xargs.1")}
+	l := NewLzss(10, 6, 2)
+
+	archive, err := l.EncodeFrames(inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputs, err := l.DecodeFrames(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != len(inputs) {
+		t.Fatalf("decoded %d frames of %d", len(outputs), len(inputs))
+	}
+
+	for i, input := range inputs {
+		err := checkRoundTrip(input, outputs[i])
+		if err != nil {
+			t.Errorf("DecodeFrames, frame %d: %s", i, err)
+		}
+
+		output, err := l.DecodeFrame(archive, i)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Errorf("DecodeFrame %d: %s", i, err)
+		}
+	}
+
+	for _, index := range []int{-1, len(inputs)} {
+		_, err = l.DecodeFrame(archive, index)
+		if err == nil {
+			t.Errorf("frame %d of %d decoded", index, len(inputs))
+		}
+	}
+
+	//Cut anywhere, in a length or in a stream, some frame is missing bytes
+	for length := 0; length < len(archive); length += 1 {
+		_, err := l.DecodeFrames(archive[:length])
+		if !errors.Is(err, ErrUnexpectedEOF) {
+			t.Fatalf("an archive cut at %d bytes returned %v, want ErrUnexpectedEOF", length, err)
+		}
+	}
+
+	//A frame that is corrupt, not short, is named
+	frames, err := getFrames(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := bytes.Clone(archive)
+	corrupt[len(archive)-len(frames[4])] = 0xff
+
+	_, err = l.DecodeFrames(corrupt)
+	if err == nil || !strings.HasPrefix(err.Error(), "Frame 4: ") {
+		t.Errorf("a corrupt last frame returned %v, want an error for frame 4", err)
+	}
+}
+
+func TestEncodeWithFallback(t *testing.T) {
+	l := NewLzss(10, 6, 2)
+
+	cases := map[string]struct {
+		input []byte
+		mode  byte
+	}{
+		"text":   {readCorpus(t, "grammar.lsp"), fallbackCompressed},
+		"random": {getRandomInput(5000, 23), fallbackStored},
+		"byte":   {[]byte{7}, fallbackStored},
+		"empty":  {[]byte{}, fallbackCompressed},
+	}
+
+	for name, c := range cases {
+		output, err := l.EncodeWithFallback(c.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if output[0] != c.mode {
+			t.Errorf("%s: mode %d, want %d", name, output[0], c.mode)
+		}
+		if len(output) > len(c.input)+1 {
+			t.Errorf("%s: %d bytes grew to %d", name, len(c.input), len(output))
+		}
+		if c.mode == fallbackStored && !bytes.Equal(output[1:], c.input) {
+			t.Errorf("%s: the input was not stored as is", name)
+		}
+
+		decoded, err := l.DecodeWithFallback(output)
+		if err == nil {
+			err = checkRoundTrip(c.input, decoded)
+		}
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+
+	_, err := l.DecodeWithFallback([]byte{2, 'a'})
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("an unknown mode returned %v, want ErrCorrupt", err)
+	}
+
+	_, err = l.DecodeWithFallback(nil)
+	if !errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("no mode returned %v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestDecodeWithLength(t *testing.T) {
+	input := readCorpus(t, "xargs.1")
+
+	for name, l := range getTestConfigs() {
+		compressed, err := l.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := l.GetOriginalLength(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		output, length, err := l.DecodeWithLength(compressed)
+		if err == nil {
+			err = checkRoundTrip(input, output)
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if length != expected || length != uint32(len(output)) {
+			t.Errorf("%s: returned a length of %d, GetOriginalLength %d, for %d bytes", name, length, expected, len(output))
+		}
+
+		//The header still declares the length when the tokens are cut short
+		_, length, err = l.DecodeWithLength(compressed[:len(compressed)/2])
+		if !errors.Is(err, ErrUnexpectedEOF) || length != expected {
+			t.Errorf("%s: half the stream returned a length of %d, %v, want %d and ErrUnexpectedEOF", name, length, err, expected)
+		}
+	}
+
+	l := NewLzss(10, 6, 2)
+	output, length, err := l.DecodeWithLength(nil)
+	if err != nil || length != 0 || len(output) != 0 {
+		t.Errorf("empty input returned %d bytes and a length of %d, %v", len(output), length, err)
+	}
+
+	_, length, err = l.DecodeWithLength([]byte{0x80})
+	if !errors.Is(err, ErrUnexpectedEOF) || length != 0 {
+		t.Errorf("a cut header returned a length of %d, %v, want 0 and ErrUnexpectedEOF", length, err)
+	}
+
+	//One allocation, the output, as for Decode
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(20, func() {
+		l.DecodeWithLength(compressed)
+	})
+	if allocs != 1 {
+		t.Errorf("DecodeWithLength allocated %v times, want once", allocs)
+	}
+}
+
+func TestEncodeTrace(t *testing.T) {
+	input := readCorpus(t, "alice29.txt")[:20000]
+
+	for name, l := range getTestConfigs() {
+		expected, err := l.Encode(input)
+		if err != nil {
+			t.Fatalf("%s: Encode: %s", name, err)
+		}
+
+		output, tokens, err := l.EncodeTrace(input)
+		if err != nil {
+			t.Fatalf("%s: EncodeTrace: %s", name, err)
+		}
+
+		if !bytes.Equal(output, expected) {
+			t.Fatalf("%s: EncodeTrace writes other bytes than Encode", name)
+		}
+
+		//Replaying the trace as a decoder would must rebuild the input, each token where it says
+		replayed := make([]byte, 0, len(input))
+		for _, token := range tokens {
+			if token.Index != uint32(len(replayed)) {
+				t.Fatalf("%s: token at %d claims index %d", name, len(replayed), token.Index)
+			}
+
+			if !token.IsPair {
+				replayed = append(replayed, token.Literal)
+				continue
+			}
+
+			if token.Offset == 0 || token.Offset > uint32(len(replayed)) {
+				t.Fatalf("%s: pair at %d reaches %d bytes back", name, token.Index, token.Offset)
+			}
+			for i := uint32(0); i < token.Length; i += 1 {
+				replayed = append(replayed, replayed[len(replayed)-int(token.Offset)])
+			}
+		}
+
+		if err := checkRoundTrip(input, replayed); err != nil {
+			t.Fatalf("%s: replaying the trace: %s", name, err)
+		}
+
+		if !reflect.DeepEqual(tokens, l.Tokens(input)) {
+			t.Fatalf("%s: the trace differs from Tokens", name)
+		}
+	}
+}
+
+func TestBitFields(t *testing.T) {
+	for _, lsbFirst := range []bool{false, true} {
+		l := NewLzss(10, 6, 2)
+		l.LSBFirst = lsbFirst
+
+		//The widest field a uint32 holds, a full one and the largest of each narrower width
+		fields := []struct {
+			value uint32
+			bits  byte
+		}{{math.MaxUint32, 32}, {0x80000001, 32}, {0, 32}, {1, 1}, {0, 1}, {1<<31 - 1, 31}, {0x5a, 7}, {0, 0}}
+
+		stream := l.newBitStream(make([]byte, 32))
+		for _, f := range fields {
+			err := stream.writeUint32(f.value, f.bits)
+			if err != nil {
+				t.Fatalf("LSBFirst %t: writing %d in %d bits: %s", lsbFirst, f.value, f.bits, err)
+			}
+		}
+		err := stream.flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stream = l.newBitStream(stream.buffer[:stream.bufferPosition])
+		for _, f := range fields {
+			value, err := stream.readUint32(f.bits)
+			if err != nil || value != f.value {
+				t.Errorf("LSBFirst %t: %d in %d bits read back as %d, %v", lsbFirst, f.value, f.bits, value, err)
+			}
+		}
+
+		stream = l.newBitStream(make([]byte, 32))
+		if err := stream.writeUint32(0, 33); !errors.Is(err, ErrFieldTooWide) {
+			t.Errorf("LSBFirst %t: writing 33 bits returned %v, want ErrFieldTooWide", lsbFirst, err)
+		}
+		if _, err := stream.readUint32(33); !errors.Is(err, ErrFieldTooWide) {
+			t.Errorf("LSBFirst %t: reading 33 bits returned %v, want ErrFieldTooWide", lsbFirst, err)
+		}
+
+		for _, f := range []struct {
+			value uint32
+			bits  byte
+		}{{2, 1}, {1 << 31, 31}, {256, 8}, {1, 0}, {math.MaxUint32, 31}} {
+			if err := stream.writeUint32(f.value, f.bits); !errors.Is(err, ErrFieldOverflow) {
+				t.Errorf("LSBFirst %t: writing %d in %d bits returned %v, want ErrFieldOverflow", lsbFirst, f.value, f.bits, err)
+			}
+		}
+
+		//The failed writes left nothing behind
+		if stream.bufferPosition != 0 || stream.bitCount != 0 {
+			t.Errorf("LSBFirst %t: failed writes wrote %d bytes and %d bits", lsbFirst, stream.bufferPosition, stream.bitCount)
+		}
+	}
+}
+
+func TestDecodeTo(t *testing.T) {
+	inputs := [][]byte{{1}, readCorpus(t, "grammar.lsp"), getRandomInput(2000, 18), make([]byte, 10000)}
+
+	for name, l := range getTestConfigs() {
+		for _, input := range inputs {
+			compressed, err := l.Encode(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dst := make([]byte, len(input))
+			n, err := l.DecodeTo(dst, compressed)
+			if err != nil || n != len(dst) || !bytes.Equal(dst, input) {
+				t.Errorf("%s: DecodeTo an exact dst wrote %d of %d bytes, %v", name, n, len(dst), err)
+			}
+
+			//One byte short fails before writing anything
+			short := make([]byte, len(input)-1)
+			n, err = l.DecodeTo(short, compressed)
+			if !errors.Is(err, ErrShortBuffer) || n != 0 {
+				t.Errorf("%s: DecodeTo a dst one byte short returned %d, %v, want ErrShortBuffer", name, n, err)
+			}
+			if bytes.Count(short, []byte{0}) != len(short) {
+				t.Errorf("%s: a dst one byte short was written to", name)
+			}
+		}
+	}
+
+	l := NewLzss(10, 6, 2)
+	input := readCorpus(t, "grammar.lsp")
+	compressed, err := l.Encode(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Room to spare is left as it was
+	dst := bytes.Repeat([]byte{0xaa}, len(input)+10)
+	n, err := l.DecodeTo(dst, compressed)
+	if err != nil || n != len(input) || !bytes.Equal(dst[:n], input) || bytes.Count(dst[n:], []byte{0xaa}) != 10 {
+		t.Errorf("DecodeTo a larger dst wrote %d bytes, %v", n, err)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		l.DecodeTo(dst, compressed)
+	})
+	if allocs != 0 {
+		t.Errorf("DecodeTo allocated %v times", allocs)
+	}
+
+	n, err = l.DecodeTo(nil, nil)
+	if err != nil || n != 0 {
+		t.Errorf("an empty stream decoded to %d bytes, %v", n, err)
+	}
+}
+
+func TestEncodeAppend(t *testing.T) {
+	input := readCorpus(t, "grammar.lsp")
+
+	for name, l := range getTestConfigs() {
+		expected, err := l.Encode(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		//Appended after what dst holds, which is kept
+		prefix := []byte("prefix")
+		output, err := l.EncodeAppend(bytes.Clone(prefix), input)
+		if err != nil || !bytes.Equal(output[:len(prefix)], prefix) || !bytes.Equal(output[len(prefix):], expected) {
+			t.Errorf("%s: EncodeAppend after %d bytes returned %d bytes, %v", name, len(prefix), len(output), err)
+		}
+
+		//Twice in a row, as a stream of concatenated blocks would be built
+		output, err = l.EncodeAppend(output, input)
+		if err != nil || !bytes.Equal(output[len(prefix)+len(expected):], expected) {
+			t.Errorf("%s: a second EncodeAppend returned %d bytes, %v", name, len(output), err)
+		}
+	}
+
+	l := NewLzss(10, 6, 2)
+	dst := make([]byte, 0, 10+l.GetUpperBound(uint32(len(input))))
+	dst = append(dst, "0123456789"...)
+
+	output, err := l.EncodeAppend(dst, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &output[0] != &dst[0] {
+		t.Error("EncodeAppend grew a dst with room for the output")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		l.EncodeAppend(dst, input)
+	})
+	if allocs != 0 {
+		t.Errorf("EncodeAppend into a dst with room allocated %v times", allocs)
+	}
+
+	output, err = l.EncodeAppend(dst, nil)
+	if err != nil || len(output) != len(dst) {
+		t.Errorf("an empty input appended %d bytes, %v", len(output)-len(dst), err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	l := NewLzss(10, 6, 2)
+	a := token{literal: 'a', length: 1}
+
+	valid, err := l.Encode(readCorpus(t, "grammar.lsp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//A match one byte past the end, once the header declares 3 bytes instead of 4
+	pastEnd := writeTestStream(t, l, []token{a, {isPair: true, offset: 1, length: 3}})
+	pastEnd[0] = 3
+
+	//A literal is 9 bits of the 16 written, leaving 7 padding bits to set
+	padded := writeTestStream(t, l, []token{a})
+	padded[len(padded)-1] |= 1
+
+	limited, padding, exact := l, l, l
+	limited.MaxTokens = 1
+	padding.Trailing = TrailingZeroPadding
+	exact.Trailing = TrailingExactEnd
+
+	cases := map[string]struct {
+		l        Lzss
+		input    []byte
+		expected error
+		position string //Where the error says it was found, for errors in a token
+	}{
+		"truncated header":    {l, []byte{0x80}, ErrUnexpectedEOF, ""},
+		"truncated tokens":    {l, valid[:len(valid)-2], ErrUnexpectedEOF, "(token "},
+		"length header":       {l, []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0}, ErrCorrupt, ""},
+		"offset 0":            {l, writeTestStream(t, l, []token{a, {isPair: true, offset: 0, length: 2}}), ErrInvalidBackReference, "(token 1 at bit 17)"},
+		"before the start":    {l, writeTestStream(t, l, []token{a, {isPair: true, offset: 2, length: 2}}), ErrInvalidBackReference, "(token 1 at bit 17)"},
+		"past the end":        {l, pastEnd, ErrInvalidBackReference, "(token 1 at bit 17)"},
+		"more than MaxTokens": {limited, writeTestStream(t, l, []token{a, a}), ErrTooManyTokens, ""},
+		"padding bits":        {padding, padded, ErrTrailingBits, ""},
+		"trailing bytes":      {exact, append(writeTestStream(t, l, []token{a}), 0), ErrTrailingBytes, ""},
+	}
+
+	for name, c := range cases {
+		_, err := c.l.Decode(c.input)
+		if !errors.Is(err, c.expected) {
+			t.Errorf("%s: returned %v, want %v", name, err, c.expected)
+			continue
+		}
+
+		//Back-references are corrupt streams too
+		if errors.Is(c.expected, ErrInvalidBackReference) && !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: %v is not ErrCorrupt", name, err)
+		}
+
+		if !strings.Contains(err.Error(), c.position) {
+			t.Errorf("%s: %q does not say %q", name, err, c.position)
+		}
+	}
+
+	//A valid stream into too small a buffer
+	_, err = l.DecodeTo(make([]byte, 10), valid)
+	if !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("a short dst returned %v, want ErrShortBuffer", err)
+	}
+}
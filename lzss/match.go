@@ -0,0 +1,314 @@
+package lzss
+
+type match struct {
+	offset, length uint32
+}
+
+type token struct {
+	isPair  bool
+	offset  uint32
+	length  uint32 //1 for literals
+	literal byte
+}
+
+// A match is only worth emitting if its token is strictly cheaper than the literals it
+// replaces. With 10,6,2 every match qualifies (17 bits against 18), with wider fields the
+// shortest ones don't, which raises the effective minimum length
+func (l *Lzss) isUsable(m match) bool {
+	if m.length < l.minimumLength {
+		return false
+	}
+
+	return 1+uint64(l.offsetBits)+uint64(l.lengthBits) < 9*uint64(m.length)
+}
+
+// Scans input[offset:index] for the longest match at index, uncapped. Returns the position
+// of the match and its length, the closest of equal length ones. With noOverlap a match never
+// extends past index.
+func findLongestMatch(input []byte, offset uint32, index uint32, noOverlap bool) (uint32, uint32) {
+	inputLength := uint32(len(input))
+
+	bestOffset := uint32(0)
+	bestLength := uint32(0)
+
+	for offset < index && offset < inputLength {
+		length := uint32(0)
+		maxLength := inputLength - index
+		if noOverlap && index-offset < maxLength {
+			maxLength = index - offset
+		}
+
+		for length < maxLength && input[offset+length] == input[index+length] {
+			length += 1
+		}
+
+		//Candidates only get closer, but a tie is decided on the distance rather than the order
+		if length > bestLength || length == bestLength && index-offset < index-bestOffset {
+			bestLength = length
+			bestOffset = offset
+		}
+
+		offset += 1
+	}
+
+	return bestOffset, bestLength
+}
+
+// The state a parse keeps between match searches: a hash chain, or the window scan when the
+// chain can't be used (no minimumLength, or memory limited by MaxEncodeMemory)
+type matchFinder struct {
+	chain *hashChain
+}
+
+func (l *Lzss) getMatchFinder(input []byte, floor uint32) matchFinder {
+	return matchFinder{chain: l.getHashChain(input, floor)}
+}
+
+func (f *matchFinder) release() {
+	putHashChain(f.chain)
+}
+
+func (f *matchFinder) findLongestMatch(input []byte, offset uint32, index uint32, noOverlap bool) (uint32, uint32) {
+	if f.chain != nil {
+		return f.chain.findLongestMatch(input, offset, index, noOverlap)
+	}
+
+	return findLongestMatch(input, offset, index, noOverlap)
+}
+
+// Match is a back-reference to Length bytes starting Offset bytes before the current position.
+type Match struct {
+	Offset uint32
+	Length uint32
+}
+
+// MatchFinder searches for matches in place of the built-in search (a hash chain, or a scan of
+// the whole window). FindMatch returns the best match for input[index:] in input[:index], with
+// a Length below minimumLength for none. It is called with increasing index for one input at a
+// time, so a stateful finder can index positions as it goes, and must start over when index
+// goes back or input changes. Of equal length matches it should return the closest, like the
+// built-in search, which Encode cannot check.
+//
+// Encode trusts the bytes of the match but enforces the stream's limits: a match reaching past
+// maxOffset (or before the start of a block) is dropped, and one running past maximumLength,
+// the end of input or, with NoOverlap, its offset is cut short. AlignHint is not applied.
+//
+// A finder that keeps positions between calls can also have a Reset method, see Lzss.Reset.
+type MatchFinder interface {
+	FindMatch(input []byte, index uint32) Match
+}
+
+// Reset drops the state kept from earlier inputs, so no position of them is ever matched by
+// the next Encode. That is the Finder's, if it has a Reset method, which keeps its tables for
+// reuse. The hash chains and scratch buffers of the built-in search come from pools and are
+// cleared every time they are taken, so there is nothing else to reset.
+func (l *Lzss) Reset() {
+	if finder, ok := l.Finder.(interface{ Reset() }); ok {
+		finder.Reset()
+	}
+}
+
+type scanFinder struct {
+	l *Lzss
+
+	//The input scanned, to notice when FindMatch moves on to another
+	base   *byte
+	length int
+
+	index   uint32 //The last index searched, plus 1
+	longest uint32 //The longest match found there, uncapped
+
+	carried []carriedLength //By distance
+}
+
+// A candidate at distance d that matched L bytes at index-1 matches at least L-1 bytes at
+// index, so when the parse searches adjacent positions the scan can carry those lengths
+// forward instead of comparing them again. Looking them up costs more than comparing the first
+// few bytes, so only matches of carryLength bytes or more are carried, and only after a
+// position whose longest match was carryThreshold bytes or more: on English text carrying
+// saves too little to pay for itself.
+const (
+	carryLength    = 3
+	carryThreshold = 16
+)
+
+type carriedLength struct {
+	next   uint32 //The index this length can be carried forward to
+	length uint32
+}
+
+// NewScanFinder returns the MatchFinder that scans every position in the window, the slowest
+// search but the simplest to check others against. It picks the same matches as the
+// built-in search.
+//
+// On repetitive input, where candidates match for hundreds of bytes, it carries the lengths
+// found at one position to the next, so Lazy and Optimal parses, which search adjacent
+// positions, compare each byte about once: several times faster with Optimal (see
+// BenchmarkScanFinder). That takes 8 bytes per position of the window or input, whichever is
+// smaller, and makes it unsafe for concurrent use, so it can't be used with EncodeParallel.
+func (l *Lzss) NewScanFinder() MatchFinder {
+	return &scanFinder{l: l}
+}
+
+func (f *scanFinder) FindMatch(input []byte, index uint32) Match {
+	l := f.l
+	if index+max(l.minimumLength, 1) > uint32(len(input)) {
+		return Match{}
+	}
+
+	//Lengths carried from another input, or from an earlier pass over this one, are stale
+	if &input[0] != f.base || len(input) != f.length || index < f.index {
+		size := min(l.maxOffset, uint32(len(input))) + 1
+		if uint32(cap(f.carried)) < size {
+			f.carried = make([]carriedLength, size)
+		}
+		f.carried = f.carried[:size]
+		clear(f.carried)
+
+		f.base, f.length = &input[0], len(input)
+		f.longest = 0
+	}
+
+	offset := ternary(l.maxOffset > index, 0, index-l.maxOffset)
+	bestOffset, bestLength := uint32(0), uint32(0)
+	if f.longest >= carryThreshold {
+		bestOffset, bestLength = f.findLongestMatch(input, offset, index, l.noOverlap())
+	} else {
+		bestOffset, bestLength = findLongestMatch(input, offset, index, l.noOverlap())
+	}
+	f.index, f.longest = index+1, bestLength
+
+	return Match{Offset: index - bestOffset, Length: min(bestLength, l.getMaximumMatchLength())}
+}
+
+// Reset forgets the input being scanned, so the next FindMatch carries nothing forward even
+// if it is the same buffer with new contents.
+func (f *scanFinder) Reset() {
+	f.base, f.length = nil, 0
+}
+
+// findLongestMatch carrying lengths from the last position, if it was index-1, to the next
+func (f *scanFinder) findLongestMatch(input []byte, offset uint32, index uint32, noOverlap bool) (uint32, uint32) {
+	inputLength := uint32(len(input))
+
+	bestOffset := uint32(0)
+	bestLength := uint32(0)
+	carried := f.carried
+	adjacent := f.index == index
+
+	for offset < index && offset < inputLength {
+		distance := index - offset
+		length := uint32(0)
+		maxLength := inputLength - index
+		if noOverlap && distance < maxLength {
+			maxLength = distance
+		}
+
+		for length < min(maxLength, carryLength) && input[offset+length] == input[index+length] {
+			length += 1
+		}
+
+		//The rest is compared as usual, which takes one comparison if the carried match ended
+		//on a mismatch, or none if it ran to the end of input
+		if length == carryLength {
+			if adjacent && carried[distance].next == index && carried[distance].length > carryLength {
+				length = carried[distance].length - 1
+			}
+
+			for length < maxLength && input[offset+length] == input[index+length] {
+				length += 1
+			}
+
+			carried[distance] = carriedLength{next: index + 1, length: length}
+		}
+
+		if length > bestLength || length == bestLength && distance < index-bestOffset {
+			bestLength = length
+			bestOffset = offset
+		}
+
+		offset += 1
+	}
+
+	return bestOffset, bestLength
+}
+
+// Applies the stream's limits to a match from a custom Finder
+func (l *Lzss) getFinderMatch(input []byte, floor uint32, index uint32) match {
+	found := l.Finder.FindMatch(input, index)
+	if found.Length < l.minimumLength || found.Offset == 0 || found.Offset > l.maxOffset || found.Offset > index-floor {
+		return match{}
+	}
+
+	length := min(found.Length, l.getMaximumMatchLength(), uint32(len(input))-index)
+	if l.noOverlap() {
+		length = min(length, found.Offset)
+	}
+
+	return match{offset: found.Offset, length: length}
+}
+
+// Matches never start before floor, nor run past the end of input. Of the matches with the
+// longest uncapped length the closest one wins, the smallest index - offset, which is the rule
+// every port follows and so part of the byte-exact output. A match longer than maximumLength
+// is only cut short after that choice.
+func (l *Lzss) getLongestMatch(input []byte, floor uint32, index uint32, finder *matchFinder) match {
+	inputLength := uint32(len(input))
+
+	//A match may run up to the end of the input, but not past it
+	if index+l.minimumLength > inputLength {
+		return match{}
+	}
+
+	if l.Finder != nil {
+		return l.getFinderMatch(input, floor, index)
+	}
+
+	offset := ternary(l.maxOffset > index-floor, floor, index-l.maxOffset)
+	maximumLength := l.getMaximumMatchLength()
+	bestOffset, bestLength := finder.findLongestMatch(input, offset, index, l.noOverlap())
+	bestLength = ternary(bestLength > maximumLength, maximumLength, bestLength)
+
+	//An aligned match wins even if it is one byte shorter
+	if l.AlignHint > 1 {
+		alignedOffset, alignedLength := findLongestAlignedMatch(input, offset, index, l.AlignHint, l.noOverlap())
+		alignedLength = ternary(alignedLength > maximumLength, maximumLength, alignedLength)
+
+		if alignedLength >= l.minimumLength && alignedLength > 0 && alignedLength+1 >= bestLength {
+			bestOffset, bestLength = alignedOffset, alignedLength
+		}
+	}
+
+	return match{
+		offset: index - bestOffset,
+		length: bestLength,
+	}
+}
+
+// Like findLongestMatch, but only considers distances that are a multiple of align
+func findLongestAlignedMatch(input []byte, offset uint32, index uint32, align uint32, noOverlap bool) (uint32, uint32) {
+	inputLength := uint32(len(input))
+
+	bestOffset := uint32(0)
+	bestLength := uint32(0)
+
+	for distance := (index - offset) / align * align; distance > 0; distance -= align {
+		candidate := index - distance
+		length := uint32(0)
+		maxLength := inputLength - index
+		if noOverlap && distance < maxLength {
+			maxLength = distance
+		}
+
+		for length < maxLength && input[candidate+length] == input[index+length] {
+			length += 1
+		}
+
+		if length > bestLength || length == bestLength && distance < index-bestOffset {
+			bestLength = length
+			bestOffset = candidate
+		}
+	}
+
+	return bestOffset, bestLength
+}
@@ -0,0 +1,290 @@
+package lzss
+
+import "fmt"
+
+// Parameters of Haruhiko Okumura's LZSS.C (1989), which many tools and game engines copied
+const (
+	okumuraRingSize  = 4096                               //N, the ring buffer of history
+	okumuraMaxLength = 18                                 //F, the longest match
+	okumuraThreshold = 2                                  //Matches this long or shorter are coded as literals
+	okumuraStart     = okumuraRingSize - okumuraMaxLength //Where the first byte is written in the ring
+	okumuraRingMask  = okumuraRingSize - 1
+	okumuraNil       = okumuraRingSize //No node, for the tree links
+	okumuraFiller    = ' '             //What the ring holds before any byte is written, see DecodeOkumuraFill
+)
+
+// EncodeOkumura compresses input in the format of Okumura's LZSS.C, the same bytes its Encode
+// writes for the same input. The format has no header, so the decoded length must be known
+// some other way or taken from how far DecodeOkumura gets.
+//
+// Each group of up to 8 tokens is preceded by a flag byte read from the lowest bit, 1 for a
+// literal byte and 0 for a match of 2 bytes,
+//
+//	[position low 8 bits] [position high 4 bits << 4 | length - 3]
+//
+// where the position is absolute in a 4096 byte ring that starts out full of spaces, with the
+// first byte written at 4078.
+func EncodeOkumura(input []byte) []byte {
+	e := okumuraEncoder{}
+	return e.encode(input)
+}
+
+// DecodeOkumura decompresses a stream in the format of Okumura's LZSS.C, as written by
+// EncodeOkumura. Like LZSS.C it stops at the end of input even if the last flag byte promises
+// more tokens, so only a match cut in half is reported, as ErrUnexpectedEOF.
+func DecodeOkumura(input []byte) ([]byte, error) {
+	return DecodeOkumuraFill(input, okumuraFiller)
+}
+
+// DecodeOkumuraFill is DecodeOkumura with the ring starting out full of fill instead of
+// spaces, for the many copies of LZSS.C that clear it with zeros. A fill no stream expects,
+// such as 0xff, makes matches into the ring before the first byte stand out while debugging
+// an encoder. This ring is the only initial window in the package: the Lzss decoders copy
+// matches from the output itself, and reject any that reach before its start with
+// ErrInvalidBackReference.
+func DecodeOkumuraFill(input []byte, fill byte) ([]byte, error) {
+	ring := [okumuraRingSize]byte{}
+	for i := range okumuraStart {
+		ring[i] = fill
+	}
+
+	output := make([]byte, 0, 2*len(input))
+	r := uint32(okumuraStart)
+	position := 0
+
+	for position < len(input) {
+		flags := input[position]
+		position += 1
+
+		for bit := 0; bit < 8 && position < len(input); bit += 1 {
+			if flags&(1<<bit) != 0 {
+				c := input[position]
+				position += 1
+
+				output = append(output, c)
+				ring[r] = c
+				r = (r + 1) & okumuraRingMask
+				continue
+			}
+
+			if len(input)-position < 2 {
+				return output, fmt.Errorf("%w (match at byte %d)", ErrUnexpectedEOF, position)
+			}
+
+			i, j := uint32(input[position]), uint32(input[position+1])
+			position += 2
+
+			i |= (j & 0xf0) << 4
+			length := j&0x0f + okumuraThreshold + 1
+
+			for k := range length {
+				c := ring[(i+k)&okumuraRingMask]
+				output = append(output, c)
+				ring[r] = c
+				r = (r + 1) & okumuraRingMask
+			}
+		}
+	}
+
+	return output, nil
+}
+
+// okumuraEncoder is LZSS.C's encoder: the ring, with its first F-1 bytes repeated after it so
+// comparisons don't wrap, and a binary search tree of the ring positions per first byte. It is
+// kept as close to the original as Go allows, since which of several equal matches it picks
+// decides the output bytes.
+type okumuraEncoder struct {
+	text [okumuraRingSize + okumuraMaxLength - 1]byte
+
+	//Tree links by ring position. The roots for each first byte are rson[N+1+byte].
+	lson [okumuraRingSize + 1]int
+	rson [okumuraRingSize + 257]int
+	dad  [okumuraRingSize + 1]int
+
+	matchPosition int
+	matchLength   int
+}
+
+func (e *okumuraEncoder) insertNode(r int) {
+	cmp := 1
+	key := e.text[r:]
+	p := okumuraRingSize + 1 + int(key[0])
+
+	e.rson[r], e.lson[r] = okumuraNil, okumuraNil
+	e.matchLength = 0
+
+	for {
+		if cmp >= 0 {
+			if e.rson[p] == okumuraNil {
+				e.rson[p] = r
+				e.dad[r] = p
+				return
+			}
+			p = e.rson[p]
+		} else {
+			if e.lson[p] == okumuraNil {
+				e.lson[p] = r
+				e.dad[r] = p
+				return
+			}
+			p = e.lson[p]
+		}
+
+		i := 1
+		for ; i < okumuraMaxLength; i += 1 {
+			if cmp = int(key[i]) - int(e.text[p+i]); cmp != 0 {
+				break
+			}
+		}
+
+		if i > e.matchLength {
+			e.matchPosition = p
+			if e.matchLength = i; i >= okumuraMaxLength {
+				break
+			}
+		}
+	}
+
+	//r matches p as far as is ever compared, so it takes its place
+	e.dad[r] = e.dad[p]
+	e.lson[r] = e.lson[p]
+	e.rson[r] = e.rson[p]
+	e.dad[e.lson[p]] = r
+	e.dad[e.rson[p]] = r
+
+	if e.rson[e.dad[p]] == p {
+		e.rson[e.dad[p]] = r
+	} else {
+		e.lson[e.dad[p]] = r
+	}
+
+	e.dad[p] = okumuraNil
+}
+
+func (e *okumuraEncoder) deleteNode(p int) {
+	if e.dad[p] == okumuraNil {
+		return
+	}
+
+	var q int
+	if e.rson[p] == okumuraNil {
+		q = e.lson[p]
+	} else if e.lson[p] == okumuraNil {
+		q = e.rson[p]
+	} else {
+		q = e.lson[p]
+		if e.rson[q] != okumuraNil {
+			for e.rson[q] != okumuraNil {
+				q = e.rson[q]
+			}
+
+			e.rson[e.dad[q]] = e.lson[q]
+			e.dad[e.lson[q]] = e.dad[q]
+			e.lson[q] = e.lson[p]
+			e.dad[e.lson[p]] = q
+		}
+
+		e.rson[q] = e.rson[p]
+		e.dad[e.rson[p]] = q
+	}
+
+	e.dad[q] = e.dad[p]
+	if e.rson[e.dad[p]] == p {
+		e.rson[e.dad[p]] = q
+	} else {
+		e.lson[e.dad[p]] = q
+	}
+
+	e.dad[p] = okumuraNil
+}
+
+func (e *okumuraEncoder) encode(input []byte) []byte {
+	for i := okumuraRingSize + 1; i <= okumuraRingSize+256; i += 1 {
+		e.rson[i] = okumuraNil
+	}
+	for i := range okumuraRingSize {
+		e.dad[i] = okumuraNil
+	}
+
+	//At worst every 8 literals take 9 bytes
+	output := make([]byte, 0, len(input)+(len(input)+7)/8)
+	code := make([]byte, 1, 17)
+	mask := byte(1)
+
+	s, r := 0, okumuraStart
+	for i := range okumuraStart {
+		e.text[i] = okumuraFiller
+	}
+
+	position := 0
+	length := 0
+	for ; length < okumuraMaxLength && position < len(input); length += 1 {
+		e.text[r+length] = input[position]
+		position += 1
+	}
+
+	if length == 0 {
+		return output
+	}
+
+	for i := 1; i <= okumuraMaxLength; i += 1 {
+		e.insertNode(r - i)
+	}
+	e.insertNode(r)
+
+	for length > 0 {
+		e.matchLength = min(e.matchLength, length)
+
+		if e.matchLength <= okumuraThreshold {
+			e.matchLength = 1
+			code[0] |= mask
+			code = append(code, e.text[r])
+		} else {
+			code = append(code,
+				byte(e.matchPosition),
+				byte((e.matchPosition>>4)&0xf0|(e.matchLength-(okumuraThreshold+1))))
+		}
+
+		if mask <<= 1; mask == 0 {
+			output = append(output, code...)
+			code = code[:1]
+			code[0] = 0
+			mask = 1
+		}
+
+		lastMatchLength := e.matchLength
+
+		i := 0
+		for ; i < lastMatchLength && position < len(input); i += 1 {
+			c := input[position]
+			position += 1
+
+			e.deleteNode(s)
+			e.text[s] = c
+			if s < okumuraMaxLength-1 {
+				e.text[s+okumuraRingSize] = c
+			}
+
+			s = (s + 1) & okumuraRingMask
+			r = (r + 1) & okumuraRingMask
+			e.insertNode(r)
+		}
+
+		//Past the end of input, the lookahead only drains
+		for ; i < lastMatchLength; i += 1 {
+			e.deleteNode(s)
+			s = (s + 1) & okumuraRingMask
+			r = (r + 1) & okumuraRingMask
+
+			if length -= 1; length > 0 {
+				e.insertNode(r)
+			}
+		}
+	}
+
+	if len(code) > 1 {
+		output = append(output, code...)
+	}
+
+	return output
+}
@@ -0,0 +1,30 @@
+package lzss
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeOkumuraFill(t *testing.T) {
+	//A flag byte for a match, of 3 bytes from position 0 of the ring, long before the first byte
+	stream := []byte{0x00, 0x00, 0x00}
+
+	for fill, expected := range map[byte][]byte{' ': []byte("   "), 0: {0, 0, 0}, 0xff: {0xff, 0xff, 0xff}} {
+		output, err := DecodeOkumuraFill(stream, fill)
+		if err != nil || !bytes.Equal(output, expected) {
+			t.Errorf("fill %#x decoded to % x, %v, want % x", fill, output, err, expected)
+		}
+	}
+
+	output, err := DecodeOkumura(stream)
+	if err != nil || !bytes.Equal(output, []byte("   ")) {
+		t.Errorf("DecodeOkumura decoded to %q, %v, want the spaces LZSS.C fills with", output, err)
+	}
+
+	//LZSS.C matches leading spaces against the ring, so another fill shows where it did
+	input := append(bytes.Repeat([]byte{' '}, 40), "after the spaces"...)
+	output, err = DecodeOkumuraFill(EncodeOkumura(input), 0xff)
+	if err != nil || !bytes.Equal(output, append(bytes.Repeat([]byte{0xff}, 40), "after the spaces"...)) {
+		t.Errorf("leading spaces decoded to %q, %v, want them as the 0xff fill", output, err)
+	}
+}
@@ -0,0 +1,71 @@
+package lzss
+
+import "fmt"
+
+// Option configures the Lzss returned by New.
+type Option func(*Lzss)
+
+// New returns a codec with the parameters of NewLzss(10, 6, 2), the ones the rosetta vectors
+// use, changed by opts. The parameters are validated like NewLzssChecked's.
+func New(opts ...Option) (Lzss, error) {
+	l := NewLzss(10, 6, 2)
+	l.maxOffset = 0 //Unless WithMaxOffset sets it, derived from offsetBits below
+	for _, opt := range opts {
+		opt(&l)
+	}
+
+	//The options only set the parameters, the limits derived from them are recomputed here
+	checked, err := NewLzssChecked(l.offsetBits, l.lengthBits, l.minimumLength)
+	if err != nil {
+		return Lzss{}, err
+	}
+
+	if l.maxOffset > checked.maxOffset {
+		return Lzss{}, fmt.Errorf("%w: maxOffset %d is not in 1..%d", ErrInvalidConfig, l.maxOffset, checked.maxOffset)
+	}
+
+	l.maxOffset = ternary(l.maxOffset == 0, checked.maxOffset, l.maxOffset)
+	l.maximumLength = checked.maximumLength
+
+	return l, nil
+}
+
+// WithOffsetBits sets the width of match offsets, so the window is 2^bits-1 bytes.
+func WithOffsetBits(bits byte) Option {
+	return func(l *Lzss) { l.offsetBits = bits }
+}
+
+// WithMaxOffset sets how far back matches may reach, up to the 2^offsetBits-1 the offset
+// field holds, for a smaller window than the field allows. 0 keeps the full range.
+func WithMaxOffset(offset uint32) Option {
+	return func(l *Lzss) { l.maxOffset = offset }
+}
+
+// WithLengthBits sets the width of match lengths.
+func WithLengthBits(bits byte) Option {
+	return func(l *Lzss) { l.lengthBits = bits }
+}
+
+// WithMinimumLength sets the shortest match emitted, which New requires to be in
+// 1..2^lengthBits-1, the longest length the field holds. With BiasedLength the field stores
+// lengths minus minimumLength instead, so raising it also raises the longest match. Matches
+// whose token costs as many bits as their literals (1+offsetBits+lengthBits against 9 per
+// byte) are never emitted, so wide fields raise the effective minimum above this one.
+func WithMinimumLength(length uint32) Option {
+	return func(l *Lzss) { l.minimumLength = length }
+}
+
+// WithLazy sets Lazy.
+func WithLazy(lazy bool) Option {
+	return func(l *Lzss) { l.Lazy = lazy }
+}
+
+// WithOptimal sets Optimal.
+func WithOptimal(optimal bool) Option {
+	return func(l *Lzss) { l.Optimal = optimal }
+}
+
+// WithMatchFinder sets Finder.
+func WithMatchFinder(finder MatchFinder) Option {
+	return func(l *Lzss) { l.Finder = finder }
+}
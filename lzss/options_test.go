@@ -0,0 +1,57 @@
+package lzss
+
+import (
+	"errors"
+	"testing"
+)
+
+// The parameters NewLzss sets, and the options New has setters for
+func getOptions(l Lzss) [8]any {
+	return [8]any{l.offsetBits, l.lengthBits, l.maxOffset, l.minimumLength, l.maximumLength, l.Lazy, l.Optimal, l.Finder}
+}
+
+func TestNew(t *testing.T) {
+	l, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getOptions(l) != getOptions(NewLzss(10, 6, 2)) {
+		t.Errorf("New() is %v, want NewLzss(10, 6, 2)", getOptions(l))
+	}
+
+	finder := l.NewScanFinder()
+	l, err = New(WithOffsetBits(12), WithLengthBits(4), WithMinimumLength(3), WithLazy(true), WithOptimal(true), WithMatchFinder(finder))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := NewLzss(12, 4, 3)
+	expected.Lazy, expected.Optimal, expected.Finder = true, true, finder
+	if getOptions(l) != getOptions(expected) {
+		t.Errorf("New with options is %v, want %v", getOptions(l), getOptions(expected))
+	}
+
+	//A smaller window than the offset field holds
+	l, err = New(WithMaxOffset(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range l.Tokens(readCorpus(t, "xargs.1")) {
+		if token.Offset > 100 {
+			t.Fatalf("match at %d reaches back %d bytes, past the window of 100", token.Index, token.Offset)
+		}
+	}
+
+	invalid := map[string][]Option{
+		"offset bits":    {WithOffsetBits(0)},
+		"length bits":    {WithLengthBits(32)},
+		"minimum length": {WithMinimumLength(0)},
+		"max offset":     {WithOffsetBits(8), WithMaxOffset(256)},
+	}
+	for name, opts := range invalid {
+		_, err := New(opts...)
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("an invalid %s returned %v, want ErrInvalidConfig", name, err)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package lzss
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// Input bytes per block of EncodeParallel when ParallelBlockSize is 0
+const defaultParallelBlockSize = 1 << 20
+
+func (l *Lzss) getParallelBlockSize() uint32 {
+	return ternary(l.ParallelBlockSize == 0, defaultParallelBlockSize, l.ParallelBlockSize)
+}
+
+// EncodeParallel splits input into blocks of ParallelBlockSize bytes and encodes them on
+// runtime.NumCPU() goroutines. Each block is
+//
+//	[varint compressed length] [Encode of the block]
+//
+// so it has its own length header, and its matches never reach into other blocks, which
+// costs some ratio at every block boundary. With ParallelChecksum each block is the
+// EncodeWithChecksum of its input instead. Decode the result with DecodeParallel.
+//
+// Metrics and Finder are used from several goroutines at once, so they must be safe for
+// concurrent use. OnProgress is called once per block, in no particular block order, but
+// never concurrently. Only blocks have a 32-bit length header, so the input may be larger
+// than 4 GiB, though the OnProgress counts then stop at math.MaxUint32.
+func (l *Lzss) EncodeParallel(input []byte) ([]byte, error) {
+	blockSize := int(l.getParallelBlockSize())
+	blocks := make([][]byte, (len(input)+blockSize-1)/blockSize)
+
+	//Each block on its own is only incompressible if the whole input is, and progress is
+	//reported across blocks
+	worker := *l
+	worker.FailIncompressible = false
+	worker.OnProgress = nil
+
+	encode := ternary(l.ParallelChecksum, worker.EncodeWithChecksum, worker.Encode)
+
+	var progress sync.Mutex
+	done, written := uint64(0), uint64(0)
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+
+	next := make(chan int)
+	for range min(runtime.NumCPU(), len(blocks)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for block := range next {
+				start := block * blockSize
+				end := min(start+blockSize, len(input))
+
+				output, err := encode(input[start:end])
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+					continue
+				}
+
+				blocks[block] = output
+
+				if l.OnProgress != nil {
+					progress.Lock()
+					done += uint64(end - start)
+					written += uint64(len(output))
+					l.OnProgress(saturateUint32(done), saturateUint32(uint64(len(input))), saturateUint32(written))
+					progress.Unlock()
+				}
+			}
+		}()
+	}
+
+	for block := range blocks {
+		next <- block
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	outputLength := 0
+	for _, block := range blocks {
+		outputLength += binary.MaxVarintLen32 + len(block)
+	}
+
+	output := make([]byte, 0, outputLength)
+	for _, block := range blocks {
+		output = binary.AppendUvarint(output, uint64(len(block)))
+		output = append(output, block...)
+	}
+
+	if l.FailIncompressible && len(output) >= len(input) {
+		return nil, ErrIncompressible
+	}
+
+	return output, nil
+}
+
+func saturateUint32(n uint64) uint32 {
+	return uint32(min(n, math.MaxUint32))
+}
+
+// DecodeParallel decompresses the output of EncodeParallel with the same configuration,
+// reading the blocks in order. Errors name the block they were found in, which with
+// ParallelChecksum includes ErrChecksumMismatch for a block that decodes to the wrong bytes.
+func (l *Lzss) DecodeParallel(input []byte) ([]byte, error) {
+	//Find the blocks and their decoded lengths first, so the output is allocated once
+	var blocks [][]byte
+	outputLength := uint64(0)
+
+	for len(input) > 0 {
+		blockLength, n := binary.Uvarint(input)
+		if n <= 0 || blockLength == 0 || blockLength > uint64(len(input)-n) {
+			return nil, fmt.Errorf("Block %d: %w: invalid block header", len(blocks), ErrCorrupt)
+		}
+
+		block := input[n : n+int(blockLength)]
+		input = input[n+int(blockLength):]
+
+		originalLength, err := l.GetOriginalLength(block)
+		if err != nil {
+			return nil, fmt.Errorf("Block %d: %w", len(blocks), err)
+		}
+
+		err = l.checkOriginalLength(originalLength, uint32(len(block)))
+		if err != nil {
+			return nil, fmt.Errorf("Block %d: %w", len(blocks), err)
+		}
+
+		blocks = append(blocks, block)
+		outputLength += uint64(originalLength)
+	}
+
+	if outputLength > math.MaxInt {
+		return nil, fmt.Errorf("%w: invalid length header", ErrCorrupt)
+	}
+
+	output := make([]byte, outputLength)
+	position := 0
+	for i, block := range blocks {
+		var decoded []byte
+		var err error
+		if l.ParallelChecksum {
+			decoded, err = l.decodeWithChecksumTo(output[position:], block)
+		} else {
+			decoded, err = l.decodeTo(output[position:], block, nil)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Block %d: %w", i, err)
+		}
+
+		position += len(decoded)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,80 @@
+package lzss
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Text long enough for several blocks of parallelTestBlockSize
+func getParallelInput(t testing.TB) []byte {
+	return bytes.Repeat(readCorpus(t, "alice29.txt"), 3)
+}
+
+const parallelTestBlockSize = 64 * 1024
+
+func TestEncodeParallel(t *testing.T) {
+	input := getParallelInput(t)
+	l := NewLzss(12, 4, 2)
+	l.ParallelBlockSize = parallelTestBlockSize
+
+	compressed, err := l.EncodeParallel(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//The same as encoding the blocks one after another
+	var serial []byte
+	for start := 0; start < len(input); start += parallelTestBlockSize {
+		block, err := l.Encode(input[start:min(start+parallelTestBlockSize, len(input))])
+		if err != nil {
+			t.Fatal(err)
+		}
+		serial = binary.AppendUvarint(serial, uint64(len(block)))
+		serial = append(serial, block...)
+	}
+	if !bytes.Equal(compressed, serial) {
+		t.Error("the blocks differ from Encode of each block")
+	}
+
+	output, err := l.DecodeParallel(compressed)
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeParallelChecksum(t *testing.T) {
+	input := getParallelInput(t)
+	l := NewLzss(12, 4, 2)
+	l.ParallelBlockSize = parallelTestBlockSize
+	l.ParallelChecksum = true
+
+	compressed, err := l.EncodeParallel(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := l.DecodeParallel(compressed)
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Change the stored CRC-32 of the second block, right after its length header
+	first, n := binary.Uvarint(compressed)
+	_, m := binary.Uvarint(compressed[n+int(first):])
+	checksum := n + int(first) + m + int(l.getHeaderLength(parallelTestBlockSize))
+	compressed[checksum] ^= 1
+
+	_, err = l.DecodeParallel(compressed)
+	if !errors.Is(err, ErrChecksumMismatch) || !strings.HasPrefix(err.Error(), "Block 1:") {
+		t.Errorf("a wrong checksum in block 1 returned %v", err)
+	}
+}
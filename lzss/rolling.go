@@ -0,0 +1,37 @@
+package lzss
+
+// Largest prime below 2^16, the modulus of Adler-32
+const adlerModulus = 65521
+
+// RollingAdler32 is the Adler-32 of a window of bytes that slides over its input one byte at
+// a time, updated in constant time instead of hashed again. A port can key its match search
+// on it, or checksum blocks of a stream, and compare each window against the Go side while
+// debugging, since Sum32 equals hash/adler32.Checksum of the bytes in the window.
+type RollingAdler32 struct {
+	a, b   uint32
+	length uint32 //Of the window, modulo adlerModulus
+}
+
+// NewRollingAdler32 returns the rolling hash of window, whose length stays the same as it
+// rolls.
+func NewRollingAdler32(window []byte) *RollingAdler32 {
+	h := &RollingAdler32{a: 1, length: uint32(len(window) % adlerModulus)}
+	for _, b := range window {
+		h.a = (h.a + uint32(b)) % adlerModulus
+		h.b = (h.b + h.a) % adlerModulus
+	}
+
+	return h
+}
+
+// Roll slides the window one byte on, dropping out, its first byte, and appending in.
+func (h *RollingAdler32) Roll(out, in byte) {
+	//Every byte left in the window is summed into b once less, and the initial 1 of a with them
+	h.a = (h.a + adlerModulus - uint32(out) + uint32(in)) % adlerModulus
+	h.b = (h.b + adlerModulus - h.length*uint32(out)%adlerModulus + h.a + adlerModulus - 1) % adlerModulus
+}
+
+// Sum32 returns the Adler-32 of the window.
+func (h *RollingAdler32) Sum32() uint32 {
+	return h.b<<16 | h.a
+}
@@ -0,0 +1,37 @@
+package lzss
+
+import (
+	"bytes"
+	"hash/adler32"
+	"testing"
+)
+
+func TestRollingAdler32(t *testing.T) {
+	inputs := map[string][]byte{
+		"text":   readCorpus(t, "alice29.txt")[:20000],
+		"random": getRandomInput(20000, 24),
+		"0xff":   bytes.Repeat([]byte{0xff}, 20000),
+	}
+
+	//Windows past 5552 bytes, where a and b overflow 32 bits unless reduced as they go
+	for name, input := range inputs {
+		for _, size := range []int{1, 4, 64, 5552, 10000} {
+			h := NewRollingAdler32(input[:size])
+			for start := 0; ; start += 1 {
+				expected := adler32.Checksum(input[start : start+size])
+				if h.Sum32() != expected {
+					t.Fatalf("%s: the window of %d bytes at %d hashes to %08x, adler32 to %08x", name, size, start, h.Sum32(), expected)
+				}
+
+				if start+size == len(input) {
+					break
+				}
+				h.Roll(input[start], input[start+size])
+			}
+		}
+	}
+
+	if NewRollingAdler32(nil).Sum32() != adler32.Checksum(nil) {
+		t.Error("the empty window does not hash to 1")
+	}
+}
@@ -0,0 +1,441 @@
+package lzss
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Input bytes the Writer collects before it encodes them as a block
+const writerBlockSize = 64 * 1024
+
+// Writer compresses everything written to it as a block-framed stream, for inputs too big to
+// hold in memory. Each block is
+//
+//	[varint decoded length] [varint compressed length] [tokens, flushed to a whole byte]
+//
+// and a decoded length of 0 ends the stream, followed with StreamChecksum by the IEEE CRC-32
+// of all of the input as a big-endian uint32. Matches may reach back into earlier blocks, up
+// to maxOffset bytes, so blocks must be decoded in order. Varints are unsigned LEB128, as in
+// encoding/binary.
+//
+// Before the end of the stream a block is only encoded once LookaheadBytes more input follow
+// it, which its last matches may run into, so the blocks don't cut matches short.
+type Writer struct {
+	lzss Lzss
+	w    io.Writer
+
+	window    []byte //History of up to maxOffset bytes, then the pending input
+	history   int
+	lookahead int    //Pending input held back from every block but the last
+	output    []byte //Scratch for one encoded block
+	dict      []byte //History the stream starts with, see NewWriterDict
+	checksum  uint32 //CRC-32 of the input so far, for StreamChecksum
+
+	err error
+}
+
+// NewWriter returns a Writer compressing to w. Close must be called to end the stream.
+func (l *Lzss) NewWriter(w io.Writer) *Writer {
+	lookahead := int(max(l.LookaheadBytes, l.getMaximumMatchLength()))
+
+	return &Writer{
+		lzss:      *l,
+		w:         w,
+		window:    make([]byte, 0, int(l.maxOffset)+writerBlockSize+lookahead),
+		lookahead: lookahead,
+	}
+}
+
+// NewWriterDict is NewWriter with dict as history preceding the input, like flate's
+// NewWriterDict, so early matches can reach back into it. Only its last maxOffset bytes are
+// used, and only NewReaderDict with the same dict can read the stream.
+func (l *Lzss) NewWriterDict(w io.Writer, dict []byte) *Writer {
+	z := l.NewWriter(w)
+	z.dict = bytes.Clone(l.getDictHistory(dict))
+	z.Reset(w)
+
+	return z
+}
+
+var ErrWriterClosed = errors.New("Writer is closed")
+
+// Reset makes the Writer start a new stream to w, as NewWriter or NewWriterDict would, with
+// the same dict. It keeps its buffers and those of its Finder, so Writers can be pooled. Input
+// not written by Close is dropped.
+func (z *Writer) Reset(w io.Writer) {
+	z.lzss.Reset()
+	z.w = w
+	z.window = append(z.window[:0], z.dict...)
+	z.history = len(z.dict)
+	z.checksum = 0
+	z.err = nil
+}
+
+// Write buffers p, encoding and writing a block to the underlying writer every
+// writerBlockSize bytes.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), cap(z.window)-len(z.window))
+		z.window = append(z.window, p[:n]...)
+		z.checksum = crc32.Update(z.checksum, crc32.IEEETable, p[:n])
+		p = p[n:]
+		written += n
+
+		if len(z.window) == cap(z.window) {
+			z.err = z.writeBlock(z.lookahead)
+			if z.err != nil {
+				return written, z.err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// ReadFrom writes everything read from r until io.EOF, reading straight into the window, and
+// returns the number of bytes read. Errors from r are returned but leave the Writer usable.
+// Close must still be called to end the stream.
+func (z *Writer) ReadFrom(r io.Reader) (int64, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+
+	read := int64(0)
+	for {
+		//writeBlock keeps at most maxOffset bytes and the lookahead, so there is always room left
+		n, err := r.Read(z.window[len(z.window):cap(z.window)])
+		z.checksum = crc32.Update(z.checksum, crc32.IEEETable, z.window[len(z.window):len(z.window)+n])
+		z.window = z.window[:len(z.window)+n]
+		read += int64(n)
+
+		if len(z.window) == cap(z.window) {
+			z.err = z.writeBlock(z.lookahead)
+			if z.err != nil {
+				return read, z.err
+			}
+		}
+
+		if err == io.EOF {
+			return read, nil
+		}
+
+		if err != nil {
+			return read, err
+		}
+	}
+}
+
+// Flush encodes all of the pending input as a block and writes it, so a Reader can return
+// everything written so far. Matches can't run past the flush, and a block shorter than
+// writerBlockSize costs its header, so frequent flushes cost ratio.
+func (z *Writer) Flush() error {
+	if z.err != nil {
+		return z.err
+	}
+
+	z.err = z.writeBlock(0)
+	return z.err
+}
+
+// Close writes the pending input and the end of the stream, with StreamChecksum its CRC-32.
+// It does not close the underlying writer.
+func (z *Writer) Close() error {
+	err := z.Flush()
+	if err != nil {
+		return err
+	}
+
+	end := []byte{0}
+	if z.lzss.StreamChecksum {
+		end = binary.BigEndian.AppendUint32(end, z.checksum)
+	}
+
+	_, z.err = z.w.Write(end)
+	if z.err != nil {
+		return z.err
+	}
+
+	z.err = ErrWriterClosed
+	return nil
+}
+
+var errStopParse = errors.New("Stop parsing")
+
+// Encodes the pending input as one block, up to the first token boundary after all but
+// lookahead bytes of it, then keeps the last maxOffset bytes before the boundary as history
+func (z *Writer) writeBlock(lookahead int) error {
+	if len(z.window) == z.history {
+		return nil
+	}
+
+	l := &z.lzss
+	upperBound := 2*binary.MaxVarintLen32 + int((l.getTokensUpperBound(uint64(len(z.window)-z.history))+7)/8)
+	if cap(z.output) < upperBound {
+		z.output = make([]byte, upperBound)
+	}
+
+	//Leave room in front for the frame header
+	tokens := z.output[2*binary.MaxVarintLen32 : upperBound]
+	stream := l.newBitStream(tokens)
+
+	end := uint32(len(z.window) - lookahead)
+	index := uint32(z.history)
+	err := l.parseFrom(z.window, 0, index, func(token token) error {
+		if index >= end {
+			return errStopParse
+		}
+
+		if token.isPair && l.Metrics != nil {
+			l.Metrics.Observe(MetricMatchLength, float64(token.length))
+			l.Metrics.Observe(MetricMatchOffset, float64(token.offset))
+		}
+
+		index += token.length
+		return l.writeToken(&stream, token)
+	})
+	if err != nil && err != errStopParse {
+		return err
+	}
+
+	err = stream.flush()
+	if err != nil {
+		return err
+	}
+
+	header := binary.AppendUvarint(z.output[:0], uint64(index)-uint64(z.history))
+	header = binary.AppendUvarint(header, uint64(stream.bufferPosition))
+
+	_, err = z.w.Write(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = z.w.Write(tokens[:stream.bufferPosition])
+	if err != nil {
+		return err
+	}
+
+	//Slide the window, keeping only what a later match can reach and the input not encoded yet
+	keep := min(int(index), int(l.maxOffset))
+	z.window = z.window[:copy(z.window, z.window[int(index)-keep:])]
+	z.history = keep
+
+	return nil
+}
+
+// EncodeMultiReader compresses the concatenation of rs to w as one stream of a Writer, so
+// later readers can match against earlier ones, reading each in turn without holding more
+// than the Writer's window. Read it back with NewReader.
+func (l *Lzss) EncodeMultiReader(rs []io.Reader, w io.Writer) error {
+	z := l.NewWriter(w)
+	for _, r := range rs {
+		_, err := z.ReadFrom(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return z.Close()
+}
+
+// Reader decompresses a stream written by Writer, one block at a time.
+type Reader struct {
+	lzss Lzss
+	r    *bufio.Reader
+
+	window     []byte //History of up to maxOffset bytes, then the current block
+	position   int    //Next byte of window to return
+	tokens     []byte //Scratch for one encoded block
+	dict       []byte //History the stream starts with, see NewReaderDict
+	checksum   uint32 //CRC-32 of the output so far, for StreamChecksum
+	tokenCount uint32 //Tokens read so far, for MaxTokens
+
+	err error
+}
+
+// NewReader returns a Reader decompressing from r. It may read past the end of the stream.
+// MaxTokens limits the tokens of the whole stream, and Trailing applies to every block, the
+// input after the end of the stream is not checked.
+func (l *Lzss) NewReader(r io.Reader) *Reader {
+	return &Reader{lzss: *l, r: bufio.NewReader(r)}
+}
+
+// NewReaderDict is NewReader for a stream written by NewWriterDict with the same dict.
+func (l *Lzss) NewReaderDict(r io.Reader, dict []byte) *Reader {
+	z := l.NewReader(r)
+	z.dict = bytes.Clone(l.getDictHistory(dict))
+	z.Reset(r)
+
+	return z
+}
+
+// Reset makes the Reader decompress a new stream from r, as NewReader or NewReaderDict would,
+// with the same dict. It keeps its buffers, so Readers can be pooled.
+func (z *Reader) Reset(r io.Reader) {
+	z.r.Reset(r)
+	z.window = append(z.window[:0], z.dict...)
+	z.position = len(z.window)
+	z.checksum = 0
+	z.tokenCount = 0
+	z.err = nil
+}
+
+// Read returns decoded bytes, and io.EOF once the end of the stream has been read.
+func (z *Reader) Read(p []byte) (int, error) {
+	for z.position == len(z.window) {
+		if z.err != nil {
+			return 0, z.err
+		}
+
+		z.err = z.readBlock()
+		if z.err != nil {
+			//Don't return a partly decoded block
+			z.position = len(z.window)
+		}
+	}
+
+	n := copy(p, z.window[z.position:])
+	z.position += n
+
+	return n, nil
+}
+
+// WriteTo writes the rest of the decoded stream to w, and returns the number of bytes
+// written. Reaching the end of the stream is not an error.
+func (z *Reader) WriteTo(w io.Writer) (int64, error) {
+	written := int64(0)
+	for {
+		if z.position < len(z.window) {
+			n, err := w.Write(z.window[z.position:])
+			z.position += n
+			written += int64(n)
+
+			if err == nil && z.position < len(z.window) {
+				err = io.ErrShortWrite
+			}
+
+			if err != nil {
+				return written, err
+			}
+		}
+
+		if z.err != nil {
+			if z.err == io.EOF {
+				return written, nil
+			}
+
+			return written, z.err
+		}
+
+		z.err = z.readBlock()
+		if z.err != nil {
+			z.position = len(z.window)
+		}
+	}
+}
+
+// Decodes the next block after the last maxOffset bytes of history
+func (z *Reader) readBlock() error {
+	l := &z.lzss
+
+	blockLength, err := binary.ReadUvarint(z.r)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if blockLength == 0 {
+		return z.readChecksum()
+	}
+
+	tokensLength, err := binary.ReadUvarint(z.r)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	//No token decodes to more than maximumLength bytes, nor costs more than 9 bits per byte,
+	//so other claims are corrupt
+	if blockLength > math.MaxUint32-uint64(l.maxOffset) || blockLength > tokensLength*8*uint64(max(l.getMaximumLength(), 1)) ||
+		tokensLength > (l.getTokensUpperBound(blockLength)+7)/8 {
+		return fmt.Errorf("%w: invalid block header", ErrCorrupt)
+	}
+
+	var tokens []byte
+	if uint64(cap(z.tokens)) >= tokensLength {
+		tokens = z.tokens[:tokensLength]
+		_, err = io.ReadFull(z.r, tokens)
+	} else {
+		//Grow with the data actually read, so a corrupt length doesn't allocate it up front
+		tokens, err = io.ReadAll(io.LimitReader(z.r, int64(tokensLength)))
+		z.tokens = tokens
+		if err == nil && uint64(len(tokens)) < tokensLength {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	keep := min(len(z.window), int(l.maxOffset))
+	z.window = append(z.window[:copy(z.window, z.window[len(z.window)-keep:])], make([]byte, blockLength)...)
+
+	stream := l.newBitStream(tokens)
+	for index := uint32(keep); index < uint32(len(z.window)); z.tokenCount += 1 {
+		token, err := l.readCheckedToken(&stream, index, uint32(len(z.window)), z.tokenCount)
+		if err != nil {
+			return err
+		}
+
+		token.writeTo(z.window, index)
+		index += token.length
+	}
+
+	//Every block is flushed to a whole byte, and its length is known
+	err = l.checkTrailing(&stream)
+	if err != nil {
+		return err
+	}
+
+	z.checksum = crc32.Update(z.checksum, crc32.IEEETable, z.window[keep:])
+	z.position = keep
+	return nil
+}
+
+// Reads the CRC-32 after the end of a stream with StreamChecksum, returning io.EOF if it
+// matches the output
+func (z *Reader) readChecksum() error {
+	if !z.lzss.StreamChecksum {
+		return io.EOF
+	}
+
+	var checksum [4]byte
+	_, err := io.ReadFull(z.r, checksum[:])
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if binary.BigEndian.Uint32(checksum[:]) != z.checksum {
+		return ErrChecksumMismatch
+	}
+
+	return io.EOF
+}
+
+// A stream that ends before its last block does so unexpectedly
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
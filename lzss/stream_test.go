@@ -0,0 +1,338 @@
+package lzss
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+// Reads a whole Writer stream back with a Reader
+func readStream(t *testing.T, l Lzss, compressed []byte) []byte {
+	t.Helper()
+
+	output, err := io.ReadAll(l.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output
+}
+
+func TestEncodeMultiReader(t *testing.T) {
+	file := readCorpus(t, "cp.html")
+	l := NewLzss(16, 8, 3)
+
+	var single bytes.Buffer
+	err := l.EncodeMultiReader([]io.Reader{bytes.NewReader(file)}, &single)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var double bytes.Buffer
+	err = l.EncodeMultiReader([]io.Reader{bytes.NewReader(file), bytes.NewReader(file)}, &double)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(readStream(t, l, double.Bytes()), append(bytes.Clone(file), file...)) {
+		t.Fatal("the stream does not decode to the concatenated readers")
+	}
+
+	//The second copy is a handful of maximum length matches
+	extra := double.Len() - single.Len()
+	if extra > len(file)/20 {
+		t.Errorf("the second copy of %d bytes costs %d bytes, it should match the first", len(file), extra)
+	}
+}
+
+// Writes input through a Writer with the given lookahead, returning the stream and how many
+// matches it holds
+func writeWithLookahead(t *testing.T, l Lzss, input []byte, lookahead int) ([]byte, int) {
+	t.Helper()
+
+	sink := &fakeSink{observations: map[string][]float64{}}
+	l.Metrics = sink
+
+	var compressed bytes.Buffer
+	z := l.NewWriter(&compressed)
+	if lookahead >= 0 {
+		z.lookahead = lookahead
+	}
+
+	_, err := z.Write(input)
+	if err == nil {
+		err = z.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(readStream(t, l, compressed.Bytes()), input) {
+		t.Fatalf("the stream with a lookahead of %d does not decode to the input", lookahead)
+	}
+
+	return compressed.Bytes(), len(sink.observations[MetricMatchLength])
+}
+
+func TestWriterLookahead(t *testing.T) {
+	//Every position past the first period matches for the longest length
+	input := bytes.Repeat(getRandomInput(500, 3), 4*writerBlockSize/500)
+	l := NewLzss(10, 6, 2)
+
+	l.LookaheadBytes = 1
+	if z := l.NewWriter(io.Discard); z.lookahead != int(l.getMaximumMatchLength()) {
+		t.Errorf("a lookahead of 1 was kept as %d, below the longest match", z.lookahead)
+	}
+
+	//What too short a lookahead does, cutting a match at every block boundary
+	_, cutMatches := writeWithLookahead(t, l, input, 0)
+
+	l.LookaheadBytes = 0
+	_, matches := writeWithLookahead(t, l, input, -1)
+	if matches >= cutMatches {
+		t.Errorf("the default lookahead took %d matches, as many as %d cut at block boundaries", matches, cutMatches)
+	}
+
+	//Matches start in the next block where they would have without block boundaries
+	encodeMatches := 0
+	for _, token := range l.Tokens(input) {
+		encodeMatches += ternary(token.IsPair, 1, 0)
+	}
+	if matches != encodeMatches {
+		t.Errorf("the Writer took %d matches, Encode of the whole input %d", matches, encodeMatches)
+	}
+
+	l.LookaheadBytes = 4096
+	_, longerMatches := writeWithLookahead(t, l, input, -1)
+	if longerMatches > matches {
+		t.Errorf("a longer lookahead took %d matches, more than the %d of the default", longerMatches, matches)
+	}
+}
+
+// Writes input through a Writer in chunks of the given sizes in turn, flushing after each
+func writeFlushed(t *testing.T, l Lzss, input []byte, chunks []int) []byte {
+	t.Helper()
+
+	var compressed bytes.Buffer
+	z := l.NewWriter(&compressed)
+	for i := 0; len(input) > 0; i += 1 {
+		n := min(chunks[i%len(chunks)], len(input))
+		_, err := z.Write(input[:n])
+		if err == nil {
+			err = z.Flush()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		input = input[n:]
+	}
+
+	err := z.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return compressed.Bytes()
+}
+
+func TestStreamChecksum(t *testing.T) {
+	input := readCorpus(t, "asyoulik.txt")
+	l := NewLzss(12, 4, 2)
+	l.StreamChecksum = true
+
+	expected := binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(input))
+	for _, chunks := range [][]int{{len(input)}, {1, 1000, 7}, {writerBlockSize + 3}, {100000}} {
+		compressed := writeFlushed(t, l, input, chunks)
+
+		//The whole input whatever the writes and flushes, after the 0 ending the stream
+		trailer := compressed[len(compressed)-4:]
+		if compressed[len(compressed)-5] != 0 || !bytes.Equal(trailer, expected) {
+			t.Errorf("writes of %v ended with %x, want 00 and the CRC-32 %x", chunks, compressed[len(compressed)-5:], expected)
+		}
+
+		if !bytes.Equal(readStream(t, l, compressed), input) {
+			t.Errorf("writes of %v don't decode to the input", chunks)
+		}
+
+		compressed[len(compressed)-1] ^= 1
+		_, err := io.ReadAll(l.NewReader(bytes.NewReader(compressed)))
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("a wrong trailer returned %v, want ErrChecksumMismatch", err)
+		}
+	}
+}
+
+func TestStreamChecksumBitFlips(t *testing.T) {
+	input := readCorpus(t, "xargs.1")[:1500]
+	l := NewLzss(10, 6, 2)
+	l.StreamChecksum = true
+
+	compressed := writeFlushed(t, l, input, []int{len(input)})
+
+	//As for EncodeWithChecksum, a flipped bit never decodes to other bytes
+	mismatches := 0
+	for bit := 0; bit < 8*len(compressed); bit += 1 {
+		corrupt := bytes.Clone(compressed)
+		corrupt[bit/8] ^= 0x80 >> (bit % 8)
+
+		output, err := io.ReadAll(l.NewReader(bytes.NewReader(corrupt)))
+		if err == nil && !bytes.Equal(output, input) {
+			t.Fatalf("flipping bit %d read other bytes without an error", bit)
+		}
+		mismatches += ternary(errors.Is(err, ErrChecksumMismatch), 1, 0)
+	}
+
+	if mismatches == 0 {
+		t.Error("no flipped bit was caught by the checksum")
+	}
+}
+
+// A reader that fails with err once it has returned its bytes, and hides any WriteTo
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+// A writer that fails with err after n bytes
+type failingWriter struct {
+	n   int
+	err error
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		n := f.n
+		f.n = 0
+		return n, f.err
+	}
+	f.n -= len(p)
+	return len(p), nil
+}
+
+func TestReadFromWriteTo(t *testing.T) {
+	input := readCorpus(t, "alice29.txt")
+	l := NewLzss(12, 4, 2)
+
+	var written bytes.Buffer
+	z := l.NewWriter(&written)
+	_, err := z.Write(input)
+	if err == nil {
+		err = z.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//io.Copy prefers the source's WriteTo, which bytes.Reader has, so it is hidden for the
+	//Writer's ReadFrom to be used
+	var compressed bytes.Buffer
+	z = l.NewWriter(&compressed)
+	n, err := io.Copy(z, struct{ io.Reader }{bytes.NewReader(input)})
+	if err == nil {
+		err = z.Close()
+	}
+	if err != nil || n != int64(len(input)) {
+		t.Fatalf("io.Copy into the Writer copied %d of %d bytes, %v", n, len(input), err)
+	}
+	if !bytes.Equal(compressed.Bytes(), written.Bytes()) {
+		t.Error("ReadFrom wrote another stream than Write")
+	}
+
+	var output bytes.Buffer
+	n, err = io.Copy(&output, l.NewReader(bytes.NewReader(compressed.Bytes())))
+	if err == nil {
+		err = checkRoundTrip(input, output.Bytes())
+	}
+	if err != nil || n != int64(len(input)) {
+		t.Fatalf("io.Copy from the Reader copied %d of %d bytes, %v", n, len(input), err)
+	}
+
+	//An error from the source is returned, and the Writer goes on
+	errSource := errors.New("source failed")
+	compressed.Reset()
+	z = l.NewWriter(&compressed)
+	n, err = z.ReadFrom(&failingReader{bytes.NewReader(input[:100000]), errSource})
+	if err != errSource || n != 100000 {
+		t.Errorf("a failing source read %d bytes and returned %v, want 100000 and its error", n, err)
+	}
+	_, err = z.ReadFrom(bytes.NewReader(input[100000:]))
+	if err == nil {
+		err = z.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(readStream(t, l, compressed.Bytes()), input) {
+		t.Error("the Writer lost bytes after a failing source")
+	}
+
+	//An error from the destination is returned with the bytes it took
+	errDestination := errors.New("destination failed")
+	n, err = l.NewReader(bytes.NewReader(written.Bytes())).WriteTo(&failingWriter{70000, errDestination})
+	if err != errDestination || n != 70000 {
+		t.Errorf("a failing destination took %d bytes and returned %v, want 70000 and its error", n, err)
+	}
+}
+
+func TestWriterDict(t *testing.T) {
+	text := readCorpus(t, "asyoulik.txt")
+	l := NewLzss(12, 4, 2)
+	l.StreamChecksum = true
+
+	//Longer than the window, so only its last 4095 bytes are history, which the input repeats
+	dict, input := text[:10000], text[8000:14000]
+
+	var compressed bytes.Buffer
+	z := l.NewWriterDict(&compressed, dict)
+	z.Write(input)
+	err := z.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := io.ReadAll(l.NewReaderDict(bytes.NewReader(compressed.Bytes()), dict))
+	if err == nil {
+		err = checkRoundTrip(input, output)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := writeFlushed(t, l, input, []int{len(input)})
+	if compressed.Len() >= len(plain)*3/4 {
+		t.Errorf("%d bytes with the dict, %d without: the input should match the dict", compressed.Len(), len(plain))
+	}
+
+	//The bytes of the dict past the window don't matter
+	far := append(bytes.Repeat([]byte{'x'}, 6000), dict[6000:]...)
+	output, err = io.ReadAll(l.NewReaderDict(bytes.NewReader(compressed.Bytes()), far))
+	if err != nil || !bytes.Equal(output, input) {
+		t.Errorf("a dict differing past the window returned %v", err)
+	}
+
+	//Without the dict the first matches reach before the start
+	_, err = io.ReadAll(l.NewReader(bytes.NewReader(compressed.Bytes())))
+	if !errors.Is(err, ErrInvalidBackReference) {
+		t.Errorf("reading without the dict returned %v, want ErrInvalidBackReference", err)
+	}
+
+	//A wrong dict of the same length decodes, to bytes the checksum catches
+	wrong := bytes.Clone(dict)
+	wrong[len(wrong)-100] ^= 1
+	_, err = io.ReadAll(l.NewReaderDict(bytes.NewReader(compressed.Bytes()), wrong))
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("reading with a wrong dict returned %v, want ErrChecksumMismatch", err)
+	}
+}
@@ -0,0 +1,333 @@
+package lzss
+
+import "math"
+
+// suffixArrayFinder sorts every suffix of the input once, so the positions whose suffixes
+// share the longest prefix with index are next to it in that order. Of the positions already
+// passed and within the window, the two closest to index in sorted order hold the longest
+// match, and the closest one in the input among all positions sharing that prefix is found
+// with a range query, each in about log2(len(input)) steps whatever the input looks like.
+type suffixArrayFinder struct {
+	l *Lzss
+
+	//The input indexed, to notice when FindMatch moves on to another
+	base   *byte
+	length int
+
+	rank     []uint32 //By position, where its suffix is in sorted order
+	prefixes maxTree  //By sorted order, ^ the prefix length shared with the previous suffix
+	passed   maxTree  //By sorted order, the position plus 1 once FindMatch has passed it
+	inserted uint32   //Positions before this are in passed
+}
+
+// NewSuffixArrayFinder returns a MatchFinder backed by a suffix array of the whole input,
+// which finds the longest match up to maximumLength at every position, as the scan does. Of
+// the matches that long it returns the closest, which may be closer than the scan's when a
+// farther one runs on past maximumLength, but never changes the length of a token.
+//
+// Its search takes about log2(len(input)) steps per position however repetitive the input,
+// but it first sorts the suffixes of the whole input on the first FindMatch, in one pass per
+// doubling of the longest repeat, and holds up to 36 bytes per input byte, plus 16 while
+// sorting. Sorting is most of its time: on lcet10.txt with 16,8,3 (see BenchmarkFinders) it
+// encodes at half the speed of the hash chain, to the same size. It suits large inputs
+// encoded in one call with a large window, not small or streamed ones, which sort every
+// block, and is not safe for concurrent use, so it can't be used with EncodeParallel.
+//
+// With NoOverlap the longest match that fits before index may be shorter than the one found,
+// so it can return shorter matches than the scan.
+func (l *Lzss) NewSuffixArrayFinder() MatchFinder {
+	return &suffixArrayFinder{l: l}
+}
+
+func (f *suffixArrayFinder) FindMatch(input []byte, index uint32) Match {
+	if index >= uint32(len(input)) {
+		return Match{}
+	}
+
+	if &input[0] != f.base || len(input) != f.length || index < f.inserted {
+		f.reset(input, index)
+	}
+
+	for ; f.inserted < index; f.inserted += 1 {
+		f.passed.raise(int(f.rank[f.inserted]), f.inserted+1)
+	}
+
+	return f.find(input, index)
+}
+
+// Reset forgets the input being indexed, so the next FindMatch sorts its input again even if
+// it is the same buffer with new contents.
+func (f *suffixArrayFinder) Reset() {
+	f.base, f.length = nil, 0
+}
+
+// Sorts the suffixes of input, where the positions up to maxOffset before index can be matched
+func (f *suffixArrayFinder) reset(input []byte, index uint32) {
+	l := f.l
+
+	suffixes := getSuffixArray(input)
+	f.rank = ensureLength(f.rank, len(input))
+	for i, position := range suffixes {
+		f.rank[position] = uint32(i)
+	}
+
+	//Kasai's algorithm: the prefix shared with the previous suffix only shrinks by one from
+	//each position to the next
+	f.prefixes.reset(len(input), math.MaxUint32)
+	shared := 0
+	for position := range input {
+		rank := f.rank[position]
+		if rank == 0 {
+			shared = 0
+			continue
+		}
+
+		previous := int(suffixes[rank-1])
+		for position+shared < len(input) && previous+shared < len(input) && input[position+shared] == input[previous+shared] {
+			shared += 1
+		}
+
+		f.prefixes.set(int(rank), ^uint32(shared))
+		shared = max(shared-1, 0)
+	}
+	f.prefixes.build()
+
+	f.passed.reset(len(input), 0)
+	f.passed.build()
+
+	f.base, f.length = &input[0], len(input)
+	f.inserted = ternary(l.maxOffset > index, 0, index-l.maxOffset)
+}
+
+func (f *suffixArrayFinder) find(input []byte, index uint32) Match {
+	l := f.l
+	rank := int(f.rank[index])
+	maximumLength := min(l.getMaximumMatchLength(), uint32(len(input))-index)
+
+	//Positions below this are out of the window, passed holds them plus 1
+	window := ternary(l.maxOffset > index, 0, index-l.maxOffset) + 1
+
+	length := uint32(0)
+	for _, neighbour := range []int{f.passed.lastAtLeast(rank, window), f.passed.firstAtLeast(rank+1, window)} {
+		if neighbour < 0 || neighbour == f.passed.size {
+			continue
+		}
+
+		candidate := f.passed.get(neighbour) - 1
+		shared := uint32(0)
+		for shared < maximumLength && input[candidate+shared] == input[index+shared] {
+			shared += 1
+		}
+
+		length = max(length, shared)
+	}
+
+	if length == 0 || length < l.minimumLength {
+		return Match{}
+	}
+
+	//The suffixes sharing length bytes with index are the run of them around rank, split from
+	//the rest by the first shared prefix shorter than that on either side
+	first := max(f.prefixes.lastAtLeast(rank+1, ^length+1), 0)
+	last := f.prefixes.firstAtLeast(rank+1, ^length+1) - 1
+
+	closest := f.passed.getMax(first, last+1) - 1
+	return Match{Offset: index - closest, Length: length}
+}
+
+// maxTree is a segment tree answering which of the values is the first or last one at least
+// a threshold, and the largest value of a range, in about log2(length) steps.
+type maxTree struct {
+	size  int      //Leaves, a power of two
+	nodes []uint32 //nodes[1] is the root, the children of k are 2k and 2k+1, leaves start at size
+}
+
+// Sets every value, and the padding after length of them, to fill. Call build once the
+// values are set.
+func (t *maxTree) reset(length int, fill uint32) {
+	t.size = 1
+	for t.size < length {
+		t.size <<= 1
+	}
+
+	t.nodes = ensureLength(t.nodes, 2*t.size)
+	for i := t.size; i < 2*t.size; i += 1 {
+		t.nodes[i] = fill
+	}
+}
+
+func (t *maxTree) set(k int, value uint32) {
+	t.nodes[t.size+k] = value
+}
+
+func (t *maxTree) build() {
+	for k := t.size - 1; k > 0; k -= 1 {
+		t.nodes[k] = max(t.nodes[2*k], t.nodes[2*k+1])
+	}
+}
+
+func (t *maxTree) get(k int) uint32 {
+	return t.nodes[t.size+k]
+}
+
+// Sets value k to a value that is no smaller than the one it has
+func (t *maxTree) raise(k int, value uint32) {
+	for k += t.size; k > 0 && t.nodes[k] < value; k >>= 1 {
+		t.nodes[k] = value
+	}
+}
+
+// The largest value in [start, end)
+func (t *maxTree) getMax(start, end int) uint32 {
+	result := uint32(0)
+	for start, end = start+t.size, end+t.size; start < end; start, end = start>>1, end>>1 {
+		if start&1 == 1 {
+			result = max(result, t.nodes[start])
+			start += 1
+		}
+		if end&1 == 1 {
+			end -= 1
+			result = max(result, t.nodes[end])
+		}
+	}
+
+	return result
+}
+
+// The last k before end whose value is at least threshold, or -1
+func (t *maxTree) lastAtLeast(end int, threshold uint32) int {
+	if end <= 0 {
+		return -1
+	}
+
+	k := t.size + end - 1
+	for t.nodes[k] < threshold {
+		//Up to the first node whose left sibling covers what is just before k, then to it
+		for k&1 == 0 {
+			k >>= 1
+		}
+		if k == 1 {
+			return -1
+		}
+		k -= 1
+	}
+
+	for k < t.size {
+		k = 2*k + 1
+		if t.nodes[k] < threshold {
+			k -= 1
+		}
+	}
+
+	return k - t.size
+}
+
+// The first k from start whose value is at least threshold, or the number of leaves
+func (t *maxTree) firstAtLeast(start int, threshold uint32) int {
+	if start >= t.size {
+		return t.size
+	}
+
+	k := t.size + start
+	for t.nodes[k] < threshold {
+		for k&1 == 1 {
+			k >>= 1
+		}
+		if k == 0 {
+			return t.size
+		}
+		k += 1
+	}
+
+	for k < t.size {
+		k = 2 * k
+		if t.nodes[k] < threshold {
+			k += 1
+		}
+	}
+
+	return k - t.size
+}
+
+// Returns buffer resliced to length, reallocated if it is too small
+func ensureLength(buffer []uint32, length int) []uint32 {
+	if cap(buffer) < length {
+		return make([]uint32, length)
+	}
+
+	return buffer[:length]
+}
+
+// Returns the positions of input in the order of their suffixes, by prefix doubling: after
+// the round for k the positions are sorted by their first 2k bytes, using the ranks by the
+// first k bytes of each position and of the one k bytes later as a two digit radix sort
+func getSuffixArray(input []byte) []uint32 {
+	n := len(input)
+	suffixes := make([]uint32, n)
+	if n == 0 {
+		return suffixes
+	}
+
+	rank := make([]uint32, n)
+	scratch := make([]uint32, n)
+	counts := make([]uint32, max(n, 256)+1)
+
+	for i, b := range input {
+		rank[i] = uint32(b)
+	}
+	countingSort(suffixes, nil, rank, counts[:257], n)
+
+	for k := 1; ; k <<= 1 {
+		//By the second digit: positions without one k bytes later sort first, then the others
+		//in the order of the one k bytes later
+		sorted := 0
+		for i := n - k; i < n; i += 1 {
+			scratch[sorted] = uint32(i)
+			sorted += 1
+		}
+		for _, position := range suffixes {
+			if int(position) >= k {
+				scratch[sorted] = position - uint32(k)
+				sorted += 1
+			}
+		}
+
+		//Then stably by the first
+		countingSort(suffixes, scratch, rank, counts, n)
+
+		//New ranks, equal for positions equal in both digits
+		scratch[suffixes[0]] = 0
+		for i := 1; i < n; i += 1 {
+			current, previous := int(suffixes[i]), int(suffixes[i-1])
+			same := rank[current] == rank[previous] && current+k < n && previous+k < n && rank[current+k] == rank[previous+k]
+			scratch[current] = scratch[previous] + ternary[uint32](same, 0, 1)
+		}
+		copy(rank, scratch)
+
+		if int(rank[suffixes[n-1]]) == n-1 || k >= n {
+			return suffixes
+		}
+	}
+}
+
+// Sorts the positions in order (0..n-1 if nil) stably by key into sorted, with counts at
+// least one longer than the largest key
+func countingSort(sorted, order, key, counts []uint32, n int) {
+	clear(counts)
+	for i := 0; i < n; i += 1 {
+		counts[key[i]+1] += 1
+	}
+	for i := 1; i < len(counts); i += 1 {
+		counts[i] += counts[i-1]
+	}
+
+	for i := 0; i < n; i += 1 {
+		position := uint32(i)
+		if order != nil {
+			position = order[i]
+		}
+
+		sorted[counts[key[position]]] = position
+		counts[key[position]] += 1
+	}
+}
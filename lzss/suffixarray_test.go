@@ -0,0 +1,49 @@
+package lzss
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSuffixArrayFinder(t *testing.T) {
+	inputs := map[string][]byte{
+		"text":    readCorpus(t, "alice29.txt")[:30000],
+		"grammar": readCorpus(t, "grammar.lsp"),
+		"random":  getRandomInput(5000, 4),
+		"runs":    bytes.Repeat([]byte("aaaaaaaaab"), 2000),
+		"zeros":   make([]byte, 10000),
+		"byte":    {1},
+	}
+
+	for name, l := range getTestConfigs() {
+		for inputName, input := range inputs {
+			expected := l.Tokens(input)
+
+			finder := l
+			finder.Finder = finder.NewSuffixArrayFinder()
+			tokens := finder.Tokens(input)
+
+			//Every token as long as the built-in search's, but possibly closer
+			if len(tokens) != len(expected) {
+				t.Fatalf("%s/%s: %d tokens, the built-in search took %d", name, inputName, len(tokens), len(expected))
+			}
+			for i, token := range tokens {
+				if token.Length != expected[i].Length || token.Offset > expected[i].Offset {
+					t.Fatalf("%s/%s: token %d is %+v, the built-in search took %+v", name, inputName, i, token, expected[i])
+				}
+			}
+
+			compressed, err := finder.Encode(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output, err := finder.Decode(compressed)
+			if err == nil {
+				err = checkRoundTrip(input, output)
+			}
+			if err != nil {
+				t.Errorf("%s/%s: %s", name, inputName, err)
+			}
+		}
+	}
+}
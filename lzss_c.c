@@ -244,7 +244,7 @@ typedef struct match_t
 
 static inline match_t __get_longest_match(lzss_config_t config, array_t input, uint32_t index)
 {
-    if (index + config.minimum_length >= input.length)
+    if (index + config.minimum_length > input.length)
         return (match_t){.offset = 0, .length = 0};
 
     uint32_t best_offset = 0, best_length = 0;
@@ -186,7 +186,7 @@ private:
 
     match_t get_longest_match(Array<uint8_t> input, uint32_t index)
     {
-        if (index + this->minimum_length >= input.length)
+        if (index + this->minimum_length > input.length)
             return _create_match(0, 0);
 
         uint32_t best_offset = 0, best_length = 0;
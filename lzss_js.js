@@ -118,7 +118,7 @@ class Lzss {
     }
 
     #getLongestMatch(input, index) {
-        if (index + this.minimumLength >= input.length)
+        if (index + this.minimumLength > input.length)
             return _match(0, 0);
 
         let bestOffset = 0, bestLength = 0;
@@ -128,7 +128,7 @@ public class LzssEncoder(byte offsetBits, byte lengthBits, byte minimumLength)
 
     private (uint offset, uint length) GetLongestMatch(byte[] input, uint index)
     {
-        if (index + minimumLength >= input.Length)
+        if (index + minimumLength > input.Length)
             return (0, 0);
 
         uint bestOffset = 0, bestLength = 0;
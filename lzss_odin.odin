@@ -170,7 +170,7 @@ match_t :: struct {
 __get_longest_match :: proc(lzss: lzss_t, input: []u8, index: u32) -> match_t {
 	input_length: u32 = u32(len(input))
 
-	if index + lzss.minimum_length >= input_length {
+	if index + lzss.minimum_length > input_length {
 		return match_t{offset = 0, length = 0}
 	}
 
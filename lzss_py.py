@@ -94,7 +94,7 @@ class Lzss:
         self.maximumLength = (1 << lengthBits) - 1
     
     def _get_longest_match(self, input, index):
-        if index + self.minimumLength >= len(input):
+        if index + self.minimumLength > len(input):
             return (0,0)
 
         bestOffset = 0
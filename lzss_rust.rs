@@ -162,7 +162,7 @@ fn lzss_new(offset_bits: u8, length_bits: u8, minimum_length: u32) -> Lzss {
 fn __lzss_get_longest_match<'a>(lzss: Lzss, input: &'a [u8], index: u32) -> (u32, u32) {
     let input_lenght = input.len() as u32;
 
-    if index + lzss.minimum_length >= input_lenght {
+    if index + lzss.minimum_length > input_lenght {
         return (0, 0);
     }
 
@@ -163,7 +163,7 @@ const Lzss = struct {
     const Match = struct { offset: usize, length: usize };
 
     fn getLongestMatch(lzss: *const Lzss, input: []u8, index: usize) Match {
-        if (index + lzss.minimumLength >= input.len)
+        if (index + lzss.minimumLength > input.len)
             return Match{ .offset = 0, .length = 0 };
 
         var bestOffset: usize = 0;